@@ -2,26 +2,39 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
+
 	"git.mgmt.innovo-cloud.de/obs/sim-exporter/pkg/errors"
 	"git.mgmt.innovo-cloud.de/obs/sim-exporter/pkg/metrics"
 	"github.com/spf13/cobra"
 )
 
-var checkCmd = &cobra.Command{
-	Use:   "check <file.yaml>",
-	Short: "Validate simulation config in <file.yaml>",
-	Long:  "Validate the metric simulation configuration <file.yaml>",
-	Args:  cobra.ExactArgs(1),
-	Run:   doCheck,
-}
+var (
+	render_help = "Print the configuration with templates and environment variables resolved before validating it"
+	render      = false
+
+	checkCmd = &cobra.Command{
+		Use:   "check <file.yaml|dir>...",
+		Short: "Validate simulation config in <file.yaml|dir>...",
+		Long:  "Validate the metric simulation configuration read from one or more files and/or directories. The metrics of all files are merged and must not conflict.",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   doCheck,
+	}
+)
 
 func init() {
+	checkCmd.PersistentFlags().BoolVar(&render, "render", render, render_help)
+
 	rootCmd.AddCommand(checkCmd)
 }
 
 // Any undesired but handled outcome is signaled by panicking with SimulationError
 func doCheck(cmd *cobra.Command, args []string) {
-	collection, err := metrics.FromYamlFile(args[0])
+	if render {
+		printRendered(args)
+	}
+
+	collection, err := metrics.FromYamlPaths(args)
 	if err != nil {
 		panic(&errors.SimulationError{Err: err.Error()})
 	}
@@ -31,5 +44,27 @@ func doCheck(cmd *cobra.Command, args []string) {
 		panic(&errors.SimulationError{Err: err.Error()})
 	}
 
-	fmt.Printf("%v validated successfully\n", args[0])
+	fmt.Printf("%v validated successfully\n", strings.Join(args, ", "))
+}
+
+// Print the rendered files, so that the result of substitutions is visible
+// even if it does not validate
+func printRendered(args []string) {
+	filenames, err := metrics.YamlFiles(args)
+	if err != nil {
+		panic(&errors.SimulationError{Err: err.Error()})
+	}
+	for i, filename := range filenames {
+		data, err := metrics.RenderYamlFile(filename)
+		if err != nil {
+			panic(&errors.SimulationError{Err: err.Error()})
+		}
+		if i > 0 {
+			fmt.Println("---")
+		}
+		fmt.Printf("# Source: %v\n%s", filename, data)
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			fmt.Println()
+		}
+	}
 }
@@ -10,6 +10,11 @@ import (
 func TestCheck(t *testing.T) {
 	require.PanicsWithError(t, "open no-such-file: no such file or directory", func() { doCheck(checkCmd, []string{"no-such-file"}) })
 	require.NotPanics(t, func() { doCheck(checkCmd, []string{"testdata/node_exporter.yaml"}) })
+	require.NotPanics(t, func() { doCheck(checkCmd, []string{"testdata/merge"}) })
+	require.Panics(t, func() { doCheck(checkCmd, []string{"testdata/node_exporter.yaml", "testdata/node_exporter.yaml"}) })
+	render = true
+	require.NotPanics(t, func() { doCheck(checkCmd, []string{"testdata/templated.yaml"}) })
+	render = false
 	outfile = "testdata/converted.yaml"
 	require.NotPanics(t, func() { doConvert(checkCmd, []string{"testdata/libvirt_scrape.txt"}) })
 	defer os.Remove(outfile)
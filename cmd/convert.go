@@ -4,8 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-
-	"gopkg.in/yaml.v2"
+	"time"
 
 	"git.mgmt.innovo-cloud.de/obs/sim-exporter/pkg/errors"
 	"git.mgmt.innovo-cloud.de/obs/sim-exporter/pkg/metrics"
@@ -17,6 +16,9 @@ var (
 	outfile_help = "Where to write the output to"
 	outfile      = "/dev/stdout"
 
+	outputformat_help = "Format of the output, one of yaml, json, toml. Defaults to the format of the outfile extension, yaml otherwise"
+	outputformat      = ""
+
 	maxdeviation_help = "How many percent to deviate from converted value at most (symmetrically in positive and negative direction)"
 	maxdeviation      = 50
 
@@ -29,11 +31,55 @@ var (
 	honorpct_help = "Use absolute deviation for metrics containing this string (comma separated list of substrings)"
 	honorpct      = "percent"
 
+	rulesfile_help = "File with per-metric rules which override maxdeviation, function, interval and honorpct"
+	rulesfile      = ""
+
+	samples_help = "How many snapshots to fetch from a URL source"
+	samples      = 1
+
+	sampleperiod_help = "Time between the snapshots fetched from a URL source"
+	sampleperiod      = 15 * time.Second
+
+	// Options to fetch the scrape if the source is a URL
+	fetch = metrics.FetchOptions{Timeout: 10 * time.Second}
+
+	// Which metrics and items to convert
+	filter = metrics.ConvertFilter{}
+
+	include_help      = "Only convert metrics whose name matches this regex (repeatable)"
+	exclude_help      = "Do not convert metrics whose name matches this regex (repeatable)"
+	match_help        = "Only convert items whose labels satisfy this matcher, e.g. code=~\"5..\" (repeatable)"
+	keepinternal_help = "Also convert the metrics of the prometheus go client (go_*, process_*, promhttp_*)"
+
+	// How to reduce the items
+	sample = metrics.SampleOptions{}
+
+	maxitems_help     = "Keep at most this many items per metric. 0 keeps all"
+	samplelabel_help  = "Label by whose values the kept items are chosen, so that the same values are kept in all metrics"
+	samplespread_help = "Choose the kept label values spread over the distribution of values instead of at random"
+
+	anonymize_help = "Replace the values of labels whose name matches this regex by consistent fake values (repeatable)"
+	anonymize      []string
+
+	anonymizesalt_help = "Secret to derive the fake values from. Without it, anyone can test which value was replaced"
+	anonymizesalt      = ""
+
+	inputformat_help        = "Format of the scrape, one of prometheus, openmetrics. Detected by default"
+	timeout_help            = "Timeout to fetch a URL"
+	username_help           = "Username for basic auth when fetching a URL"
+	password_help           = "Password for basic auth when fetching a URL"
+	bearertoken_help        = "Bearer token to send when fetching a URL"
+	bearertokenfile_help    = "File to read the bearer token from"
+	cafile_help             = "CA certificate(s) to verify the server certificate of a https URL"
+	certfile_help           = "Client certificate to present to a https URL"
+	keyfile_help            = "Key of the client certificate"
+	insecureskipverify_help = "Do not verify the server certificate of a https URL"
+
 	convertCmd = &cobra.Command{
-		Use:     "convert <prometheus-scrape-file>",
-		Short:   "Parse prometheus-style scrape file and create simulator yaml config",
-		Long:    "Parses data in prometheus scrape format read from <prometheus-scrape-file> and turns it into a yaml structure suitable as input for the simulator",
-		Args:    cobra.ExactArgs(1),
+		Use:     "convert <prometheus-scrape-file|url>...",
+		Short:   "Parse prometheus-style scrape file and create simulator config",
+		Long:    "Parses data in prometheus scrape format read from <prometheus-scrape-file> or fetched from an http(s) <url> and turns it into a yaml, json or toml structure suitable as input for the simulator. Given several snapshots (multiple files or --samples of a url), min, max and func of every item are derived from the observed values",
+		Args:    cobra.MinimumNArgs(1),
 		PreRunE: validateConvert,
 		Run:     doConvert,
 	}
@@ -41,10 +87,33 @@ var (
 
 func init() {
 	convertCmd.Flags().StringVarP(&outfile, "outfile", "o", outfile, outfile_help)
+	convertCmd.Flags().StringVar(&outputformat, "output-format", outputformat, outputformat_help)
 	convertCmd.Flags().IntVarP(&maxdeviation, "maxdeviation", "d", maxdeviation, maxdeviation_help)
 	convertCmd.Flags().StringVarP(&function, "function", "f", function, function_help)
 	convertCmd.Flags().StringVarP(&interval, "interval", "i", interval, interval_help)
 	convertCmd.Flags().StringVarP(&honorpct, "honorpct", "p", honorpct, honorpct_help)
+	convertCmd.Flags().StringVar(&rulesfile, "rules", rulesfile, rulesfile_help)
+	convertCmd.Flags().IntVar(&samples, "samples", samples, samples_help)
+	convertCmd.Flags().DurationVar(&sampleperiod, "sample-period", sampleperiod, sampleperiod_help)
+	convertCmd.Flags().StringVar(&fetch.Format, "input-format", fetch.Format, inputformat_help)
+	convertCmd.Flags().DurationVar(&fetch.Timeout, "timeout", fetch.Timeout, timeout_help)
+	convertCmd.Flags().StringVar(&fetch.Username, "username", fetch.Username, username_help)
+	convertCmd.Flags().StringVar(&fetch.Password, "password", fetch.Password, password_help)
+	convertCmd.Flags().StringVar(&fetch.BearerToken, "bearer-token", fetch.BearerToken, bearertoken_help)
+	convertCmd.Flags().StringVar(&fetch.BearerTokenFile, "bearer-token-file", fetch.BearerTokenFile, bearertokenfile_help)
+	convertCmd.Flags().StringVar(&fetch.CAFile, "ca-file", fetch.CAFile, cafile_help)
+	convertCmd.Flags().StringVar(&fetch.CertFile, "cert-file", fetch.CertFile, certfile_help)
+	convertCmd.Flags().StringVar(&fetch.KeyFile, "key-file", fetch.KeyFile, keyfile_help)
+	convertCmd.Flags().BoolVar(&fetch.InsecureSkipVerify, "insecure-skip-verify", fetch.InsecureSkipVerify, insecureskipverify_help)
+	convertCmd.Flags().StringArrayVar(&filter.Include, "include", filter.Include, include_help)
+	convertCmd.Flags().StringArrayVar(&filter.Exclude, "exclude", filter.Exclude, exclude_help)
+	convertCmd.Flags().StringArrayVar(&filter.Matchers, "match", filter.Matchers, match_help)
+	convertCmd.Flags().BoolVar(&filter.KeepInternal, "keep-internal", filter.KeepInternal, keepinternal_help)
+	convertCmd.Flags().IntVar(&sample.MaxItems, "max-items", sample.MaxItems, maxitems_help)
+	convertCmd.Flags().StringVar(&sample.Label, "sample-label", sample.Label, samplelabel_help)
+	convertCmd.Flags().BoolVar(&sample.Spread, "sample-spread", sample.Spread, samplespread_help)
+	convertCmd.Flags().StringArrayVar(&anonymize, "anonymize", anonymize, anonymize_help)
+	convertCmd.Flags().StringVar(&anonymizesalt, "anonymize-salt", anonymizesalt, anonymizesalt_help)
 
 	rootCmd.AddCommand(convertCmd)
 }
@@ -56,6 +125,35 @@ func validateConvert(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("maxdeviation must be in range 0-100")
 	}
 
+	// Validate sampling
+	if samples < 1 {
+		return fmt.Errorf("samples must be 1 or more")
+	}
+
+	// Validate item sampling
+	if sample.MaxItems < 0 {
+		return fmt.Errorf("max-items must not be negative")
+	}
+	if sample.MaxItems == 0 && (sample.Label != "" || sample.Spread) {
+		return fmt.Errorf("sample-label and sample-spread require max-items")
+	}
+
+	// Validate output format
+	if outputformat != "" && !metrics.IsValidFormat(outputformat) {
+		return fmt.Errorf("invalid output-format %q. Must be one of yaml, json, toml", outputformat)
+	}
+
+	// Validate fetch options
+	if !metrics.IsValidScrapeFormat(fetch.Format) {
+		return fmt.Errorf("invalid input-format %q. Must be one of prometheus, openmetrics", fetch.Format)
+	}
+	if fetch.BearerToken != "" && fetch.BearerTokenFile != "" {
+		return fmt.Errorf("only one of bearer-token and bearer-token-file can be set")
+	}
+	if (fetch.CertFile == "") != (fetch.KeyFile == "") {
+		return fmt.Errorf("cert-file and key-file must be set together")
+	}
+
 	// More complex validations performed in ScrapefileToCollection
 	return nil
 }
@@ -63,17 +161,54 @@ func validateConvert(cmd *cobra.Command, args []string) error {
 // Any undesired but handled outcome is signaled by panicking with SimulationError
 func doConvert(cmd *cobra.Command, args []string) {
 
-	collection, err := metrics.ScrapefileToCollection(args[0], maxdeviation, function, interval, honorpct)
+	var rules *metrics.ConvertRules
+	if rulesfile != "" {
+		var err error
+		rules, err = metrics.ReadConvertRules(rulesfile)
+		if err != nil {
+			panic(&errors.SimulationError{Err: err.Error()})
+		}
+	}
+
+	var collection *metrics.Collection
+	var err error
+	if len(args) == 1 && samples == 1 {
+		collection, err = metrics.ScrapeToCollection(args[0], fetch, filter, rules, maxdeviation, function, interval, honorpct)
+	} else {
+		collection, err = metrics.SnapshotsToCollection(args, fetch, filter, rules, samples, sampleperiod, function, interval, honorpct)
+	}
 	if err != nil {
 		panic(&errors.SimulationError{Err: err.Error()})
 	}
 
-	yamlData, err := yaml.Marshal(collection)
+	// Sample before anonymizing, so that the choice only depends on the
+	// source
+	if removed := collection.Sample(sample); removed > 0 {
+		log.Infof("Removed %d items by sampling", removed)
+	}
+
+	if len(anonymize) > 0 {
+		anonymizer, err := metrics.NewAnonymizer(anonymize, anonymizesalt)
+		if err != nil {
+			panic(&errors.SimulationError{Err: err.Error()})
+		}
+		log.Infof("Anonymized %d label values", collection.Anonymize(anonymizer))
+	}
+
+	format := outputformat
+	if format == "" {
+		format = metrics.FormatOfFile(outfile)
+	}
+	if format == "" {
+		format = "yaml"
+	}
+
+	data, err := collection.Marshal(format)
 	if err != nil {
 		panic(&errors.SimulationError{Err: err.Error()})
 	}
 
-	err = ioutil.WriteFile(outfile, yamlData, 0644)
+	err = ioutil.WriteFile(outfile, data, 0644)
 	if err != nil {
 		panic(&errors.SimulationError{Err: err.Error()})
 	} else {
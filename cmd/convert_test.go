@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
+	"git.mgmt.innovo-cloud.de/obs/sim-exporter/pkg/metrics"
+
 	"github.com/stretchr/testify/require"
 )
 
@@ -11,4 +17,165 @@ func TestConvert(t *testing.T) {
 	outfile = "/dev/null"
 	require.NotPanics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}) })
 	require.NotPanics(t, func() { doConvert(convertCmd, []string{"testdata/collectd_scrape.txt"}) })
+
+	for _, format := range []string{"json", "toml"} {
+		outputformat = format
+		outfile = "testdata/converted.cfg"
+		require.NotPanics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}) })
+		_, err := metrics.FromYamlFile(outfile)
+		require.NoError(t, err)
+		os.Remove(outfile)
+	}
+	outputformat = ""
+
+	// The format is taken from the outfile extension
+	outfile = "testdata/converted.json"
+	defer os.Remove(outfile)
+	require.NotPanics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}) })
+	data, err := os.ReadFile(outfile)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(data), "{"))
+
+	outputformat = "xml"
+	require.Error(t, validateConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}))
+	outputformat = ""
+}
+
+func TestConvert_url(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, "testdata/libvirt_scrape.txt")
+	}))
+	defer server.Close()
+
+	outfile = "/dev/null"
+	require.NotPanics(t, func() { doConvert(convertCmd, []string{server.URL + "/metrics"}) })
+	require.Panics(t, func() { doConvert(convertCmd, []string{server.URL + "/no-such-path"}) })
+
+	fetch.Format = "json"
+	require.Error(t, validateConvert(convertCmd, []string{server.URL}))
+	fetch.Format = ""
+
+	fetch.CertFile = "cert.pem"
+	require.Error(t, validateConvert(convertCmd, []string{server.URL}))
+	fetch.CertFile = ""
+}
+
+func TestConvert_snapshots(t *testing.T) {
+	outfile = "/dev/null"
+	require.NotPanics(t, func() {
+		doConvert(convertCmd, []string{"testdata/snapshot1.txt", "testdata/snapshot2.txt"})
+	})
+	require.Panics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt", "no-such-file"}) })
+
+	samples = 0
+	require.Error(t, validateConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}))
+	samples = 1
+}
+
+func TestConvert_openMetrics(t *testing.T) {
+	outfile = "/dev/null"
+	require.NotPanics(t, func() { doConvert(convertCmd, []string{"testdata/openmetrics_scrape.txt"}) })
+	// Read as text format, the sample with an OpenMetrics timestamp is skipped
+	fetch.Format = "prometheus"
+	require.NotPanics(t, func() { doConvert(convertCmd, []string{"testdata/openmetrics_scrape.txt"}) })
+	fetch.Format = ""
+}
+
+func TestConvert_filter(t *testing.T) {
+	outfile = "testdata/filtered.yaml"
+	defer os.Remove(outfile)
+	filter.Include = []string{"libvirt_domain_info_.*", "go_goroutines"}
+	filter.Exclude = []string{".*_meta"}
+	filter.Matchers = []string{`flavor="m1.small"`}
+	filter.KeepInternal = true
+	defer func() { filter = metrics.ConvertFilter{} }()
+
+	require.NotPanics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}) })
+	c, err := metrics.FromYamlFile(outfile)
+	require.NoError(t, err)
+	require.NotEmpty(t, c.Metrics)
+	for _, m := range c.Metrics {
+		require.True(t, strings.HasPrefix(m.Name, "libvirt_domain_info_"), m.Name)
+		require.False(t, strings.HasSuffix(m.Name, "_meta"), m.Name)
+		for _, item := range m.Items {
+			require.Equal(t, "m1.small", item.Labels["flavor"])
+		}
+	}
+
+	filter.Include = []string{"("}
+	require.Panics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}) })
+	filter.Include = nil
+	filter.Matchers = []string{"flavor"}
+	require.Panics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}) })
+}
+
+func TestConvert_anonymize(t *testing.T) {
+	outfile = "testdata/anonymized.yaml"
+	defer os.Remove(outfile)
+	anonymize = []string{"user_name", "project_name", "instance_name", ".*uuid", "source_file"}
+	defer func() { anonymize = nil }()
+
+	require.NotPanics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}) })
+	_, err := metrics.FromYamlFile(outfile)
+	require.NoError(t, err)
+	data, err := os.ReadFile(outfile)
+	require.NoError(t, err)
+	for _, secret := range []string{"Nexible", "@innovo-cloud.de", "zabbix-prod", "fd8ad5aa-6b33-4198-a05d-8be42fc0f20e", "077224dcfd454436987147de7d86fa89"} {
+		require.NotContains(t, string(data), secret)
+	}
+
+	anonymize = []string{"("}
+	require.Panics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}) })
+}
+
+func TestConvert_sample(t *testing.T) {
+	outfile = "testdata/sampled.yaml"
+	defer os.Remove(outfile)
+	sample = metrics.SampleOptions{MaxItems: 3, Label: "domain", Spread: true}
+	defer func() { sample = metrics.SampleOptions{} }()
+
+	require.NotPanics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}) })
+	c, err := metrics.FromYamlFile(outfile)
+	require.NoError(t, err)
+	// The info metrics have all domains and thus keep the same ones
+	var infoDomains []string
+	for _, m := range c.Metrics {
+		require.LessOrEqual(t, len(m.Items), 3, m.Name)
+		if !strings.HasPrefix(m.Name, "libvirt_domain_info_") {
+			continue
+		}
+		var domains []string
+		for _, item := range m.Items {
+			domains = append(domains, item.Labels["domain"])
+		}
+		if infoDomains == nil {
+			infoDomains = domains
+		}
+		require.Equal(t, infoDomains, domains, m.Name)
+	}
+	require.Len(t, infoDomains, 3)
+
+	sample = metrics.SampleOptions{MaxItems: -1}
+	require.Error(t, validateConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}))
+	sample = metrics.SampleOptions{Label: "domain"}
+	require.Error(t, validateConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}))
+}
+
+func TestConvert_rules(t *testing.T) {
+	outfile = "/dev/null"
+	rulesfile = "testdata/convert_rules.yaml"
+	defer func() { rulesfile = "" }()
+	require.NotPanics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}) })
+	require.NotPanics(t, func() {
+		doConvert(convertCmd, []string{"testdata/snapshot1.txt", "testdata/snapshot2.txt"})
+	})
+
+	rulesfile = "testdata/libvirt_scrape.txt"
+	require.Panics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}) })
+	rulesfile = "no-such-file"
+	require.Panics(t, func() { doConvert(convertCmd, []string{"testdata/libvirt_scrape.txt"}) })
 }
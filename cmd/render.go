@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"git.mgmt.innovo-cloud.de/obs/sim-exporter/pkg/errors"
+	"git.mgmt.innovo-cloud.de/obs/sim-exporter/pkg/metrics"
+)
+
+var (
+	at_help = "Simulated time to render, either the duration since the start (e.g. 90m) or a RFC 3339 timestamp relative to --start"
+	at      = "0s"
+
+	simstart_help = "RFC 3339 timestamp at which the simulation starts. Required if --at is a timestamp"
+	simstart      = ""
+
+	expositionformat_help = "Format of the output, one of prometheus, openmetrics"
+	expositionformat      = metrics.ScrapeFormatPrometheus
+
+	seed_help = "Seed of the random values, the same seed renders the same output"
+	seed      = int64(1)
+
+	renderRefresh_help = "Time between the refreshes up to --at, like for serve. 0 evaluates the items only once"
+	renderRefresh      = metrics.DefaultRefresh
+
+	renderCmd = &cobra.Command{
+		Use:     "render <file.yaml|dir>...",
+		Short:   "Print the metrics which serving <file.yaml|dir>... yields at a simulated time",
+		Long:    "Evaluate the metrics read from one or more files and/or directories at a simulated time and print the exposition which the exporter would serve, without starting a server. The values are generated by the same code as for serve.",
+		Args:    cobra.MinimumNArgs(1),
+		PreRunE: validateRender,
+		Run:     doRender,
+	}
+)
+
+func init() {
+	renderCmd.Flags().StringVar(&at, "at", at, at_help)
+	renderCmd.Flags().StringVar(&simstart, "start", simstart, simstart_help)
+	renderCmd.Flags().StringVarP(&expositionformat, "format", "f", expositionformat, expositionformat_help)
+	renderCmd.Flags().Int64Var(&seed, "seed", seed, seed_help)
+	renderCmd.Flags().DurationVarP(&renderRefresh, "refresh", "r", renderRefresh, renderRefresh_help)
+
+	rootCmd.AddCommand(renderCmd)
+}
+
+func validateRender(cmd *cobra.Command, args []string) error {
+	if _, err := renderOffset(at, simstart); err != nil {
+		return err
+	}
+	if expositionformat != metrics.ScrapeFormatPrometheus && expositionformat != metrics.ScrapeFormatOpenMetrics {
+		return fmt.Errorf("invalid format %q. Must be one of %v, %v", expositionformat, metrics.ScrapeFormatPrometheus, metrics.ScrapeFormatOpenMetrics)
+	}
+	if renderRefresh < 0 {
+		return fmt.Errorf("invalid refresh %v. Must not be negative", renderRefresh)
+	}
+	return nil
+}
+
+// The time since the start of the simulation which at refers to. at is
+// either a duration or a timestamp, the latter relative to start.
+func renderOffset(at string, start string) (time.Duration, error) {
+	var result time.Duration
+	if timestamp, err := time.Parse(time.RFC3339, at); err == nil {
+		if start == "" {
+			return 0, fmt.Errorf("--at %v is a timestamp, --start is required", at)
+		}
+		startTime, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return 0, fmt.Errorf("invalid start %q. Must be a RFC 3339 timestamp", start)
+		}
+		result = timestamp.Sub(startTime)
+	} else {
+		result, err = time.ParseDuration(at)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q. Must be a duration or a RFC 3339 timestamp", at)
+		}
+	}
+	if result < 0 {
+		return 0, fmt.Errorf("invalid time %q. Must not be before the start", at)
+	}
+	return result, nil
+}
+
+// Any undesired but handled outcome is signaled by panicking with SimulationError
+func doRender(cmd *cobra.Command, args []string) {
+	offset, err := renderOffset(at, simstart)
+	if err != nil {
+		panic(&errors.SimulationError{Err: err.Error()})
+	}
+
+	collection, err := metrics.FromYamlPaths(args)
+	if err != nil {
+		panic(&errors.SimulationError{Err: err.Error()})
+	}
+
+	rand.Seed(seed)
+	options := metrics.RenderOptions{At: offset, Refresh: renderRefresh, Format: expositionformat}
+	if err := collection.RenderExposition(cmd.OutOrStdout(), options); err != nil {
+		panic(&errors.SimulationError{Err: err.Error()})
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"git.mgmt.innovo-cloud.de/obs/sim-exporter/pkg/metrics"
+)
+
+func Test_renderOffset(t *testing.T) {
+	tests := []struct {
+		name    string
+		at      string
+		start   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "duration", at: "90m", want: 90 * time.Minute},
+		{name: "zero", at: "0s", want: 0},
+		{name: "timestamp", at: "2024-01-01T12:30:00Z", start: "2024-01-01T12:00:00+00:00", want: 30 * time.Minute},
+		{name: "timestamp-without-start", at: "2024-01-01T12:30:00Z", wantErr: true},
+		{name: "invalid-start", at: "2024-01-01T12:30:00Z", start: "noon", wantErr: true},
+		{name: "before-start", at: "2024-01-01T11:00:00Z", start: "2024-01-01T12:00:00Z", wantErr: true},
+		{name: "negative", at: "-1m", wantErr: true},
+		{name: "invalid", at: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderOffset(tt.at, tt.start)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderOffset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("renderOffset() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	var out bytes.Buffer
+	renderCmd.SetOut(&out)
+	defer renderCmd.SetOut(nil)
+
+	require.Panics(t, func() { doRender(renderCmd, []string{"no-such-file"}) })
+	require.NotPanics(t, func() { doRender(renderCmd, []string{"testdata/node_exporter.yaml"}) })
+	require.True(t, strings.Contains(out.String(), "# TYPE node_"), "prometheus text exposition expected")
+	first := out.String()
+
+	// The same seed renders the same output
+	out.Reset()
+	require.NotPanics(t, func() { doRender(renderCmd, []string{"testdata/node_exporter.yaml"}) })
+	require.Equal(t, first, out.String())
+
+	out.Reset()
+	at, simstart, expositionformat = "2024-01-01T00:10:00Z", "2024-01-01T00:00:00Z", "openmetrics"
+	defer func() { at, simstart, expositionformat = "0s", "", "prometheus" }()
+	require.NoError(t, validateRender(renderCmd, nil))
+	require.NotPanics(t, func() { doRender(renderCmd, []string{"testdata/merge"}) })
+	require.True(t, strings.HasSuffix(out.String(), "# EOF\n"), "openmetrics exposition expected")
+
+	at = "2024-01-01T00:10:00Z"
+	simstart = ""
+	require.Error(t, validateRender(renderCmd, nil))
+	require.Panics(t, func() { doRender(renderCmd, []string{"testdata/merge"}) })
+	at = "0s"
+	expositionformat = "json"
+	require.Error(t, validateRender(renderCmd, nil))
+}
+
+func TestRender_flags(t *testing.T) {
+	refresh := renderCmd.Flags().Lookup("refresh")
+	require.NotNil(t, refresh)
+	require.Equal(t, metrics.DefaultRefresh.String(), refresh.DefValue)
+	require.Nil(t, renderCmd.PersistentFlags().Lookup("refresh"))
+
+	// Independent of the refresh of serve
+	require.NoError(t, serveCmd.PersistentFlags().Set("refresh", "1m"))
+	defer func() { refreshTime = metrics.DefaultRefresh }()
+	require.Equal(t, metrics.DefaultRefresh, renderRefresh)
+}
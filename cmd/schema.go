@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"git.mgmt.innovo-cloud.de/obs/sim-exporter/pkg/errors"
+	"git.mgmt.innovo-cloud.de/obs/sim-exporter/pkg/metrics"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	schemaOutfile_help = "Where to write the schema to"
+	schemaOutfile      = "/dev/stdout"
+
+	schemaCmd = &cobra.Command{
+		Use:   "schema",
+		Short: "Print JSON schema of the simulator config",
+		Long:  "Print the JSON schema of the simulator yaml config. It can be used by IDEs for autocompletion and inline validation.",
+		Args:  cobra.NoArgs,
+		Run:   doSchema,
+	}
+)
+
+func init() {
+	schemaCmd.Flags().StringVarP(&schemaOutfile, "outfile", "o", schemaOutfile, schemaOutfile_help)
+
+	rootCmd.AddCommand(schemaCmd)
+}
+
+// Any undesired but handled outcome is signaled by panicking with SimulationError
+func doSchema(cmd *cobra.Command, args []string) {
+	schema, err := metrics.JsonSchema()
+	if err != nil {
+		panic(&errors.SimulationError{Err: err.Error()})
+	}
+
+	err = ioutil.WriteFile(schemaOutfile, append(schema, '\n'), 0644)
+	if err != nil {
+		panic(&errors.SimulationError{Err: err.Error()})
+	}
+	if schemaOutfile != "/dev/stdout" {
+		fmt.Fprintf(os.Stderr, "Wrote schema to %v\n", schemaOutfile)
+	}
+}
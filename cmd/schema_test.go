@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema(t *testing.T) {
+	schemaOutfile = "/dev/null"
+	require.NotPanics(t, func() { doSchema(schemaCmd, []string{}) })
+	schemaOutfile = "no-such-dir/schema.json"
+	require.Panics(t, func() { doSchema(schemaCmd, []string{}) })
+}
@@ -23,13 +23,13 @@ var (
 	path      = "/metrics"
 
 	refreshTime_help = "After how many seconds the metrics are refreshed"
-	refreshTime, _   = time.ParseDuration("15s")
+	refreshTime      = metrics.DefaultRefresh
 
 	serveCmd = &cobra.Command{
-		Use:     "serve <file.yaml>",
-		Short:   "Serve simulated prometheus metrics defined in <file.yaml>",
-		Long:    "Start the exporter and serve prometheus metrics read from <file.yaml> to the configured port and path.",
-		Args:    cobra.ExactArgs(1),
+		Use:     "serve <file.yaml|dir>...",
+		Short:   "Serve simulated prometheus metrics defined in <file.yaml|dir>...",
+		Long:    "Start the exporter and serve prometheus metrics read from one or more files and/or directories to the configured port and path. The metrics of all files are merged and must not conflict.",
+		Args:    cobra.MinimumNArgs(1),
 		PreRunE: validateServe,
 		Run:     doServe,
 	}
@@ -73,7 +73,7 @@ func doServe(cmd *cobra.Command, args []string) {
 		io.WriteString(w, "</body></html>\n")
 	})
 
-	collection, err := metrics.FromYamlFile(args[0])
+	collection, err := metrics.FromYamlPaths(args)
 	if err != nil {
 		panic(&errors.SimulationError{Err: err.Error()})
 	}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	regexpUUID     = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	regexpEmail    = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+	regexpIPv4     = regexp.MustCompile(`^\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}(:\d+)?$`)
+	regexpHex      = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	regexpHostname = regexp.MustCompile(`^[a-zA-Z0-9-]*[a-zA-Z][a-zA-Z0-9-]*(\.[a-zA-Z0-9-]+)+(:\d+)?$`)
+)
+
+// Replaces the values of selected labels by fake values. The same value
+// always gets the same replacement (given the same salt), so that series of
+// different metrics still join. Replacements resemble the original: UUIDs
+// (also within a value) become other UUIDs, e-mail addresses, IP addresses,
+// hostnames and hex strings become fake ones of the same kind. Anything else
+// becomes the label name with a hash.
+type Anonymizer struct {
+	labels []*regexp.Regexp
+	salt   string
+
+	// replacement by label and original value, original by label and
+	// replacement (to keep the replacement of a label unique)
+	replacements map[string]map[string]string
+	originals    map[string]map[string]string
+}
+
+// Create an anonymizer for the labels whose names match one of the regular
+// expressions (which must match the whole name). The salt makes the hashes
+// unpredictable, without it anyone can test which value was replaced.
+func NewAnonymizer(labelPatterns []string, salt string) (*Anonymizer, error) {
+	result := &Anonymizer{
+		salt:         salt,
+		replacements: make(map[string]map[string]string),
+		originals:    make(map[string]map[string]string),
+	}
+	for _, pattern := range labelPatterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid label name regex %q: %v", pattern, err)
+		}
+		result.labels = append(result.labels, re)
+	}
+	return result, nil
+}
+
+// Whether the values of the label are replaced
+func (a *Anonymizer) Selects(label string) bool {
+	return matchesAny(label, a.labels)
+}
+
+// The replacement of value as value of label
+func (a *Anonymizer) Value(label string, value string) string {
+	if value == "" || !a.Selects(label) {
+		return value
+	}
+	if replacement, ok := a.replacements[label][value]; ok {
+		return replacement
+	}
+
+	replacement := a.fake(label, value)
+	if a.originals[label] == nil {
+		a.replacements[label] = make(map[string]string)
+		a.originals[label] = make(map[string]string)
+	}
+	// Two values of a label must not get the same replacement
+	unique := replacement
+	for n := 1; a.originals[label][unique] != ""; n++ {
+		unique = fmt.Sprintf("%v-%d", replacement, n)
+	}
+	a.replacements[label][value] = unique
+	a.originals[label][unique] = value
+	return unique
+}
+
+// Replace the values of the selected labels of all items. Returns the
+// number of replaced values.
+func (c *Collection) Anonymize(a *Anonymizer) int {
+	var count int
+	for _, m := range c.Metrics {
+		for _, item := range m.Items {
+			for label, value := range item.Labels {
+				if replacement := a.Value(label, value); replacement != value {
+					item.Labels[label] = replacement
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+// Hex digits derived from s, at least n of them
+func (a *Anonymizer) hash(s string, n int) string {
+	var b strings.Builder
+	for k := 0; b.Len() < n; k++ {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%v\xff%v\xff%d", a.salt, s, k)))
+		b.WriteString(hex.EncodeToString(sum[:]))
+	}
+	return b.String()[:n]
+}
+
+// A fake value which resembles value
+func (a *Anonymizer) fake(label string, value string) string {
+	// UUIDs and e-mail addresses are also replaced within values (like paths)
+	// so that they match their replacements elsewhere
+	result := regexpUUID.ReplaceAllStringFunc(value, a.fakeUUID)
+	result = regexpEmail.ReplaceAllStringFunc(result, func(email string) string {
+		return "user-" + a.hash(email, 8) + "@example.com"
+	})
+	if result != value {
+		return result
+	}
+
+	// Ports are kept
+	var port string
+	if k := strings.LastIndex(value, ":"); k >= 0 {
+		port = value[k:]
+	}
+	switch {
+	case regexpIPv4.MatchString(value):
+		h := a.hash(value, 6)
+		return fmt.Sprintf("10.%d.%d.%d", hexByte(h[0:2]), hexByte(h[2:4]), hexByte(h[4:6])) + port
+	case regexpHex.MatchString(value):
+		return a.hash(value, len(value))
+	case regexpHostname.MatchString(value):
+		return "host-" + a.hash(value, 8) + ".example.com" + port
+	}
+	return label + "-" + a.hash(value, 8)
+}
+
+// A fake UUID (version 4) which replaces uuid
+func (a *Anonymizer) fakeUUID(uuid string) string {
+	h := a.hash(strings.ToLower(uuid), 32)
+	return h[0:8] + "-" + h[8:12] + "-4" + h[13:16] + "-" + string("89ab"[hexByte(h[16:18])%4]) + h[17:20] + "-" + h[20:32]
+}
+
+func hexByte(s string) int {
+	var result int
+	fmt.Sscanf(s, "%x", &result)
+	return result
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestAnonymizer_Value(t *testing.T) {
+	a, err := NewAnonymizer([]string{"user_name", ".*_uuid", "source_file", "instance", "host", "project_name"}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		label string
+		value string
+		want  string
+	}{
+		{name: "uuid", label: "root_uuid", value: "fd8ad5aa-6b33-4198-a05d-8be42fc0f20e", want: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{name: "embedded-uuid", label: "source_file", value: "ephemeral-vms/fd8ad5aa-6b33-4198-a05d-8be42fc0f20e_disk", want: `^ephemeral-vms/[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}_disk$`},
+		{name: "hex", label: "project_uuid", value: "077224dcfd454436987147de7d86fa89", want: `^[0-9a-f]{32}$`},
+		{name: "email", label: "user_name", value: "jane.doe@example.org", want: `^user-[0-9a-f]{8}@example\.com$`},
+		{name: "ip-port", label: "instance", value: "192.168.1.17:9100", want: `^10\.\d+\.\d+\.\d+:9100$`},
+		{name: "hostname", label: "host", value: "db1.prod.acme.com", want: `^host-[0-9a-f]{8}\.example\.com$`},
+		{name: "other", label: "project_name", value: "C00061-Nexible", want: `^project_name-[0-9a-f]{8}$`},
+		{name: "empty", label: "project_name", value: "", want: `^$`},
+		{name: "unselected", label: "flavor", value: "m1.small", want: `^m1\.small$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := a.Value(tt.label, tt.value)
+			if !regexp.MustCompile(tt.want).MatchString(got) {
+				t.Errorf("Value() = %q, want match of %q", got, tt.want)
+			}
+			if tt.value != "" && tt.label != "flavor" && got == tt.value {
+				t.Errorf("Value() = %q, want replacement", got)
+			}
+			if again := a.Value(tt.label, tt.value); again != got {
+				t.Errorf("Value() again = %q, want %q", again, got)
+			}
+		})
+	}
+
+	// UUIDs are replaced alike wherever they are
+	if uuid := a.Value("root_uuid", "fd8ad5aa-6b33-4198-a05d-8be42fc0f20e"); a.Value("source_file", "vms/fd8ad5aa-6b33-4198-a05d-8be42fc0f20e") != "vms/"+uuid {
+		t.Errorf("embedded UUID not replaced like %q", uuid)
+	}
+
+	// The replacements depend on the salt
+	b, _ := NewAnonymizer([]string{"user_name"}, "other")
+	if a.Value("user_name", "jane.doe@example.org") == b.Value("user_name", "jane.doe@example.org") {
+		t.Errorf("Value() does not depend on the salt")
+	}
+
+	if _, err := NewAnonymizer([]string{"("}, ""); err == nil {
+		t.Errorf("NewAnonymizer() with invalid regex succeeded, want error")
+	}
+}
+
+func TestAnonymizer_unique(t *testing.T) {
+	a, _ := NewAnonymizer([]string{"l"}, "")
+	// Pretend that another value already got the replacement of "b"
+	fake := a.fake("l", "b")
+	a.replacements["l"] = map[string]string{"a": fake}
+	a.originals["l"] = map[string]string{fake: "a"}
+	if got := a.Value("l", "b"); got != fake+"-1" {
+		t.Errorf("Value() = %q, want %q", got, fake+"-1")
+	}
+}
+
+func TestCollection_Anonymize(t *testing.T) {
+	c := NewCollection()
+	up := NewMetric("up", "gauge", WithLabels("instance", "job"))
+	load := NewMetric("node_load1", "gauge", WithLabels("instance"))
+	for _, err := range []error{
+		up.AddItem(NewItem(1, 1, WithLabelValues(map[string]string{"instance": "a.example.org:9100", "job": "node"}))),
+		up.AddItem(NewItem(1, 1, WithLabelValues(map[string]string{"instance": "b.example.org:9100", "job": "node"}))),
+		load.AddItem(NewItem(1, 2, WithLabelValues(map[string]string{"instance": "a.example.org:9100"}))),
+		c.AddMetric(up),
+		c.AddMetric(load),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, _ := NewAnonymizer([]string{"instance"}, "")
+	if got := c.Anonymize(a); got != 3 {
+		t.Errorf("Anonymize() = %v, want 3", got)
+	}
+	if up.Items[0].Labels["job"] != "node" {
+		t.Errorf("job = %q, want unchanged", up.Items[0].Labels["job"])
+	}
+	if up.Items[0].Labels["instance"] != load.Items[0].Labels["instance"] || up.Items[0].Labels["instance"] == up.Items[1].Labels["instance"] {
+		t.Errorf("instances = %v, %v, %v, want same replacement for same value only", up.Items[0].Labels, up.Items[1].Labels, load.Items[0].Labels)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
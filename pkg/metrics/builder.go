@@ -0,0 +1,197 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Functional options to build collections in code, e.g.
+//
+//	c := NewCollection(WithNamespace("app"))
+//	m := NewMetric("requests_total", "counter", WithHelp("Requests"), WithLabels("code"))
+//	err := m.AddItem(NewItem(1, 10, WithFunc("sin"), WithLabelValues(map[string]string{"code": "200"})))
+//	...
+//	err = c.AddMetric(m)
+//	...
+//	err = c.Validate()
+type (
+	CollectionOption func(*Collection)
+	MetricOption     func(*Metric)
+	ItemOption       func(*MetricItem)
+)
+
+// Defaults of items created by NewItem
+const (
+	DefaultFunc     = "rand"
+	DefaultInterval = time.Minute
+)
+
+// Create an empty collection of the current configuration version
+func NewCollection(opts ...CollectionOption) *Collection {
+	c := &Collection{Version: "1"}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Prefix all metric names with namespace
+func WithNamespace(namespace string) CollectionOption {
+	return func(c *Collection) {
+		c.Namespace = namespace
+	}
+}
+
+// Prefix all metric names with subsystem (after the namespace)
+func WithSubsystem(subsystem string) CollectionOption {
+	return func(c *Collection) {
+		c.Subsystem = subsystem
+	}
+}
+
+// Add labels to all series of the collection
+func WithConstLabels(labels map[string]string) CollectionOption {
+	return func(c *Collection) {
+		c.ConstLabels = make(map[string]string, len(labels))
+		for name, value := range labels {
+			c.ConstLabels[name] = value
+		}
+	}
+}
+
+// Create a metric without items
+func NewMetric(name string, metricType string, opts ...MetricOption) *Metric {
+	m := &Metric{Name: name, Type: metricType}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Set the help text of the metric
+func WithHelp(help string) MetricOption {
+	return func(m *Metric) {
+		m.Help = help
+	}
+}
+
+// Set the unit of the metric, e.g. "seconds"
+func WithUnit(unit string) MetricOption {
+	return func(m *Metric) {
+		m.Unit = unit
+	}
+}
+
+// Set the label names which every item must specify
+func WithLabels(names ...string) MetricOption {
+	return func(m *Metric) {
+		m.Labels = append([]string{}, names...)
+	}
+}
+
+// Set the states of a stateset
+func WithStates(states ...string) MetricOption {
+	return func(m *Metric) {
+		m.States = append([]string{}, states...)
+	}
+}
+
+// Replace the value of label every period and/or with a probability per
+// refresh, see Churn
+func WithChurn(label string, every time.Duration, probability float64) MetricOption {
+	return func(m *Metric) {
+		m.Churn = &Churn{Label: label, Every: every, Probability: probability}
+	}
+}
+
+// Set the bucket boundaries of a histogram
+func WithBuckets(buckets ...float64) MetricOption {
+	return func(m *Metric) {
+		m.Buckets = append([]float64{}, buckets...)
+	}
+}
+
+// Set the quantiles exposed by a summary
+func WithQuantiles(quantiles ...float64) MetricOption {
+	return func(m *Metric) {
+		m.Quantiles = append([]float64{}, quantiles...)
+	}
+}
+
+// Create an item with values between min and max. Func and interval default
+// to DefaultFunc and DefaultInterval.
+func NewItem(min float64, max float64, opts ...ItemOption) *MetricItem {
+	i := &MetricItem{Min: min, Max: max, Func: DefaultFunc, Interval: DefaultInterval}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// Set the function by which the value changes between min and max
+func WithFunc(f string) ItemOption {
+	return func(i *MetricItem) {
+		i.Func = f
+	}
+}
+
+// Set the duration in which the function repeats
+func WithInterval(interval time.Duration) ItemOption {
+	return func(i *MetricItem) {
+		i.Interval = interval
+	}
+}
+
+// Set the label values of the item
+func WithLabelValues(labels map[string]string) ItemOption {
+	return func(i *MetricItem) {
+		i.Labels = make(map[string]string, len(labels))
+		for name, value := range labels {
+			i.Labels[name] = value
+		}
+	}
+}
+
+// Let the item exist only from start to end (relative to the start of the
+// simulation). Zero end means the item never ends.
+func WithLifetime(start time.Duration, end time.Duration) ItemOption {
+	return func(i *MetricItem) {
+		i.Start = start
+		i.End = end
+	}
+}
+
+// Let the item be absent for the last "duration" of every period
+func WithAbsence(every time.Duration, duration time.Duration) ItemOption {
+	return func(i *MetricItem) {
+		i.Absence = &Absence{Every: every, For: duration}
+	}
+}
+
+// Observe a histogram or summary item rate times per second
+func WithRate(rate float64) ItemOption {
+	return func(i *MetricItem) {
+		i.Rate = rate
+	}
+}
+
+// Draw the observations of a histogram or summary item from distribution
+func WithDistribution(distribution ...Quantile) ItemOption {
+	return func(i *MetricItem) {
+		i.Distribution = append([]Quantile{}, distribution...)
+	}
+}
+
+// Start a counter item at value
+func WithInitial(value float64) ItemOption {
+	return func(i *MetricItem) {
+		i.Initial = value
+	}
+}
+
+// Add the value of a counter item upon every refresh ("increment") or per
+// second ("rate")
+func WithMode(mode string) ItemOption {
+	return func(i *MetricItem) {
+		i.Mode = mode
+	}
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewCollection(t *testing.T) {
+	c := NewCollection(WithNamespace("app"), WithSubsystem("api"), WithConstLabels(map[string]string{"env": "test"}))
+
+	m := NewMetric("requests_total", "counter", WithHelp("Requests"), WithLabels("code"))
+	if err := m.AddItem(NewItem(1, 10, WithFunc("sin"), WithInterval(time.Hour), WithLabelValues(map[string]string{"code": "200"}))); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddItem(NewItem(0, 1, WithLabelValues(map[string]string{"code": "500"}), WithLifetime(time.Minute, 0))); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddMetric(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	// The metric is added by reference
+	got, _ := c.GetMetric("requests_total")
+	if got != m || got.FullName() != "app_api_requests_total" {
+		t.Errorf("GetMetric() = %p %v, want %p app_api_requests_total", got, got.FullName(), m)
+	}
+	item := m.Items[1]
+	if item.Func != DefaultFunc || item.Interval != DefaultInterval || item.Start != time.Minute {
+		t.Errorf("item = %+v, want defaults and start", item)
+	}
+	if item.ParentMetric() != m || m.ParentCollection() != c {
+		t.Errorf("parents not set")
+	}
+}
+
+func TestCollection_Validate(t *testing.T) {
+	c := NewCollection()
+	m := NewMetric("temperature", "gauge", WithStates("hot"))
+	if err := m.AddItem(NewItem(2, 1, WithFunc("cos"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddMetric(m); err != nil {
+		t.Fatal(err)
+	}
+
+	err := c.Validate()
+	var validationErrors ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		t.Fatalf("Validate() error = %v, want ValidationErrors", err)
+	}
+	var got []string
+	for _, e := range validationErrors {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		`metric "temperature": states are only allowed for type stateset`,
+		`metric "temperature" item 0: min (2) > max (1)`,
+		`metric "temperature" item 0: unknown func "cos". Must be one of rand, asc, desc, sin`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate() errors = %q, want %q", got, want)
+	}
+}
+
+func TestMetric_AddItem(t *testing.T) {
+	m := NewMetric("a", "gauge", WithLabels("l2", "l1"))
+	if err := m.AddItem(NewItem(1, 2, WithLabelValues(map[string]string{"l1": "a", "l2": "b"}))); err != nil {
+		t.Errorf("AddItem() error = %v", err)
+	}
+	if !reflect.DeepEqual(m.Labels, []string{"l2", "l1"}) {
+		t.Errorf("Labels = %v, want the declared labels unchanged", m.Labels)
+	}
+	if err := m.AddItem(NewItem(1, 2, WithLabelValues(map[string]string{"l1": "a"}))); err == nil {
+		t.Errorf("AddItem() error = nil, want label mismatch")
+	}
+	if err := m.AddItem(NewItem(1, 2, WithLabelValues(map[string]string{"l1": "a", "l2": "b"}))); err == nil {
+		t.Errorf("AddItem() error = nil, want duplicate label set")
+	}
+
+	// Labels are taken from the first item if not declared
+	inferred := NewMetric("b", "gauge")
+	if err := inferred.AddItem(NewItem(1, 2, WithLabelValues(map[string]string{"x": "1"}))); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inferred.Labels, []string{"x"}) {
+		t.Errorf("Labels = %v, want [x]", inferred.Labels)
+	}
+	// ... but not overwritten by later items
+	if err := inferred.AddItem(NewItem(1, 2)); err == nil {
+		t.Errorf("AddItem() error = nil, want label mismatch")
+	}
+}
+
+func TestMetricItem_ValueAt(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    *MetricItem
+		elapsed time.Duration
+		want    float64
+		wantErr bool
+	}{
+		{name: "constant", item: NewItem(5, 5), elapsed: time.Hour, want: 5},
+		{name: "asc start", item: NewItem(0, 10, WithFunc("asc"), WithInterval(time.Minute)), elapsed: 0, want: 0},
+		{name: "asc middle", item: NewItem(0, 10, WithFunc("asc"), WithInterval(time.Minute)), elapsed: 30 * time.Second, want: 5},
+		{name: "asc repeats", item: NewItem(0, 10, WithFunc("asc"), WithInterval(time.Minute)), elapsed: 90 * time.Second, want: 5},
+		{name: "desc", item: NewItem(0, 10, WithFunc("desc"), WithInterval(time.Minute)), elapsed: 15 * time.Second, want: 7.5},
+		{name: "sin quarter", item: NewItem(0, 10, WithFunc("sin"), WithInterval(time.Minute)), elapsed: 15 * time.Second, want: 10},
+		{name: "unknown func", item: NewItem(0, 10, WithFunc("cos")), wantErr: true},
+		{name: "zero interval", item: NewItem(0, 10, WithInterval(0)), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.item.ValueAt(tt.elapsed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValueAt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ValueAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
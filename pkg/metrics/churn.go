@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Characters of the random suffix of k8s pod names
+const churnAlphabet = "bcdfghjklmnpqrstvwxz2456789"
+
+// Series replaced because of label churn. Registered with the default
+// registry so that it is served along with the simulated metrics.
+var churnedSeries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "sim_exporter_churned_series_total",
+		Help: "Number of simulated series which were replaced because of label churn",
+	},
+	[]string{"metric"},
+)
+
+func init() {
+	prometheus.MustRegister(churnedSeries)
+}
+
+// Labels of the series currently exposed for the item. Differs from Labels
+// if the metric has label churn.
+func (i *MetricItem) seriesLabels() map[string]string {
+	if i.churnValue == "" {
+		return i.Labels
+	}
+	result := make(map[string]string, len(i.Labels))
+	for name, value := range i.Labels {
+		result[name] = value
+	}
+	result[i.parent.Churn.Label] = i.churnValue
+	return result
+}
+
+// Regenerate the value of the churning label if due. Returns the labels of
+// the replaced series, or nil if nothing changed. The first call only
+// generates the initial value.
+func (i *MetricItem) rotate(elapsed time.Duration) map[string]string {
+	if i.parent == nil || i.parent.Churn == nil {
+		return nil
+	}
+	churn := i.parent.Churn
+
+	initial := i.churnValue == ""
+	due := initial
+	if churn.Every > 0 {
+		period := int64(elapsed / churn.Every)
+		if period != i.churnPeriod {
+			i.churnPeriod = period
+			due = true
+		}
+	}
+	if churn.Probability > 0 && rand.Float64() < churn.Probability {
+		due = true
+	}
+	if !due {
+		return nil
+	}
+
+	old := i.seriesLabels()
+	i.churnValue = i.Labels[churn.Label] + "-" + randomSuffix(5)
+	if initial {
+		return nil
+	}
+	return old
+}
+
+func randomSuffix(length int) string {
+	result := make([]byte, length)
+	for k := range result {
+		result[k] = churnAlphabet[rand.Intn(len(churnAlphabet))]
+	}
+	return string(result)
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricItem_rotate(t *testing.T) {
+	metric := &Metric{Name: "a", Labels: []string{"pod"}, Churn: &Churn{Label: "pod", Every: 10 * time.Minute}}
+	item := &MetricItem{Labels: map[string]string{"pod": "api"}, parent: metric}
+
+	if old := item.rotate(0); old != nil {
+		t.Errorf("rotate() = %v, want nil for the initial value", old)
+	}
+	first := item.seriesLabels()["pod"]
+	if !strings.HasPrefix(first, "api-") || len(first) != len("api-")+5 {
+		t.Errorf("seriesLabels() pod = %q, want api-<suffix>", first)
+	}
+	if item.Labels["pod"] != "api" {
+		t.Errorf("Labels modified: %v", item.Labels)
+	}
+
+	if old := item.rotate(9 * time.Minute); old != nil {
+		t.Errorf("rotate() = %v, want nil within the period", old)
+	}
+
+	old := item.rotate(10 * time.Minute)
+	if old["pod"] != first {
+		t.Errorf("rotate() = %v, want the replaced labels with pod %q", old, first)
+	}
+	if second := item.seriesLabels()["pod"]; second == first || !strings.HasPrefix(second, "api-") {
+		t.Errorf("seriesLabels() pod = %q, want a new value", second)
+	}
+}
+
+func TestMetricItem_rotate_probability(t *testing.T) {
+	metric := &Metric{Name: "a", Labels: []string{"pod"}, Churn: &Churn{Label: "pod", Probability: 1}}
+	item := &MetricItem{Labels: map[string]string{"pod": "api"}, parent: metric}
+
+	item.rotate(0)
+	for k := 0; k < 3; k++ {
+		if old := item.rotate(0); old == nil {
+			t.Errorf("rotate() = nil, want a replacement with probability 1")
+		}
+	}
+}
+
+func TestMetricItem_seriesLabels(t *testing.T) {
+	item := &MetricItem{Labels: map[string]string{"pod": "api"}, parent: &Metric{}}
+	if got := item.seriesLabels(); got["pod"] != "api" {
+		t.Errorf("seriesLabels() = %v, want the item labels without churn", got)
+	}
+	if old := item.rotate(time.Hour); old != nil {
+		t.Errorf("rotate() = %v, want nil without churn", old)
+	}
+}
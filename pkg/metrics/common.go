@@ -2,7 +2,10 @@ package metrics
 
 import (
 	"os"
+	"reflect"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 )
@@ -15,16 +18,17 @@ var (
 		Level:     logrus.InfoLevel,
 	}
 
-	// How a prometheus metric line must look like
-	regexpMetricItem = *regexp.MustCompile(`^(?P<name>\w+)\s*(?:|{(?P<labels>[^}]*)})\s+(?P<value>[^\s]*).*$`)
-
 	// Valid functions
 	// This should really be a constant but golang will not let me
 	validFunctions = []string{"rand", "asc", "desc", "sin"}
 
-	// Valid prometheus metric types
+	// Valid ways in which the value of a counter item is added
+	validCounterModes = []string{"increment", "rate"}
+
+	// Valid prometheus metric types, including the additional OpenMetrics
+	// types. "untyped" is the prometheus name of the OpenMetrics "unknown".
 	// This should also be a constant
-	validMetricTypes = []string{"gauge", "counter", "summary", "histogram"}
+	validMetricTypes = []string{"gauge", "counter", "summary", "histogram", "info", "stateset", "gaugehistogram", "unknown", "untyped"}
 )
 
 // Test whether searchString is an element of slice
@@ -66,3 +70,37 @@ func createMatchMap(regexp regexp.Regexp, line string) map[string]string {
 	}
 	return result
 }
+
+// Name by which a struct field is (un)marshaled, derived from its yaml tag
+func yamlFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// Create a key which is identical for identical label sets
+func labelSetKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		// 0xff cannot occur in valid utf-8 label names and values
+		b.WriteString(key + "\xff" + labels[key] + "\xff")
+	}
+	return b.String()
+}
+
+// Sorted names of a label set
+func labelNames(labels map[string]string) []string {
+	var result []string
+	for name := range labels {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"reflect"
+	"regexp"
 	"testing"
 )
 
@@ -166,6 +167,9 @@ func Test_stringSlicesEqual(t *testing.T) {
 }
 
 func Test_createMatchMap(t *testing.T) {
+	// A (simplified) prometheus sample line
+	regexpSample := *regexp.MustCompile(`^(?P<name>\w+)\s*(?:|{(?P<labels>[^}]*)})\s+(?P<value>[^\s]*).*$`)
+
 	tests := []struct {
 		line string
 		want map[string]string
@@ -249,7 +253,7 @@ func Test_createMatchMap(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.line, func(t *testing.T) {
-			if got := createMatchMap(regexpMetricItem, tt.line); !reflect.DeepEqual(got, tt.want) {
+			if got := createMatchMap(regexpSample, tt.line); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("createMatchMap() = %v, want %v", got, tt.want)
 			}
 		})
@@ -6,9 +6,10 @@ import (
 	"math"
 	"math/rand"
 	"os"
-	"strconv"
 	"strings"
 	"time"
+
+	dto "github.com/prometheus/client_model/go"
 )
 
 func init() {
@@ -35,154 +36,254 @@ func readLines(path string) (*[]string, error) {
 	return &result, nil
 }
 
-func stripQuotes(s string) string {
-	if len(s) > 0 && s[0] == '"' {
-		s = s[1:]
+// Duration for which a counter is assumed to have counted if the scrape
+// tells no start time
+const defaultCounterAge = time.Hour
+
+func convertScrapeToConfig(scrapeLines *[]string, format string, convertFilter ConvertFilter, rules *ConvertRules, maxdeviation int, function string, interval string, honorpct string) (*Collection, error) {
+
+	filter, err := convertFilter.compile()
+	if err != nil {
+		return nil, err
 	}
-	if len(s) > 0 && s[len(s)-1] == '"' {
-		s = s[:len(s)-1]
+	if err := rules.Validate(); err != nil {
+		return nil, err
 	}
-	return s
-}
 
-func convertScrapeToConfig(scrapeLines *[]string, maxdeviation int, function string, interval string, honorpct string) (*Collection, error) {
+	// The settings of items without rule. Percentages deviate absolutely
+	// and stay within 0-100.
+	fallback := func(metricName string) convertSettings {
+		result := convertSettings{
+			deviation: float64(maxdeviation),
+			function:  function,
+			interval:  interval,
+			mode:      "rate",
+		}
+		if isPercent(metricName, honorpct) {
+			zero, hundred := 0.0, 100.0
+			result.absolute = true
+			result.clamp = Clamp{Min: &zero, Max: &hundred}
+		}
+		return result
+	}
+
+	families, notes, err := parseScrape(scrapeLines, format)
+	if err != nil {
+		return nil, err
+	}
+	if len(notes) > 0 {
+		log.Warnf("Made %d assumptions about the scrape:", len(notes))
+		for _, note := range notes {
+			log.Warnf("  %v", note)
+		}
+	}
 
 	c := Collection{
 		Version: "1",
 	}
 
-	// Defines order in which metric properties must appear
-	expectHelp := true
-	expectType := false
-	expectMetric := false
-
-	// Skip predefined prometheus-internal metrics
-	skipMetric := false
-
-	var metricName string
-
-	for lineno, line := range *scrapeLines {
-		log.Debugf("%d: %v\n", lineno, line)
-		if line == "" {
-			continue
+	// Start times of counters, histograms and summaries (from which their
+	// rate is derived), either by item or of the whole process
+	created := make(map[string]float64)
+	var processStart float64
+	for _, family := range families {
+		if family.name == "process_start_time_seconds" && len(family.metrics) > 0 {
+			processStart = sampleValue(family.metrics[0])
 		}
-		if strings.HasPrefix(line, "# HELP") {
-			// line e.g. '# HELP libvirt_domain_interface_meta Interfaces metadata. Source bridge, target device, interface uuid'
-			if !expectHelp {
-				return nil, fmt.Errorf("line %v: Unexpected 'HELP' (no 'TYPE' since last 'HELP')", lineno)
+		if family.created {
+			base := strings.TrimSuffix(family.name, "_created")
+			for _, sample := range family.metrics {
+				created[itemKey(base, sampleLabels(sample))] = sampleValue(sample)
 			}
+		}
+	}
+	now := float64(time.Now().UnixNano()) / 1e9
+	startOf := func(metricName string, labels map[string]string) float64 {
+		if start, ok := created[itemKey(metricName, labels)]; ok {
+			return start
+		}
+		return processStart
+	}
 
-			expectHelp = false
-			expectType = true
+	for _, family := range families {
+		metricName := family.name
+		log.Debugf("%v: %v %v with %d samples", family.line+1, family.metricType, metricName, len(family.metrics))
+		if family.created {
+			continue
+		}
 
-			fields := strings.Split(line, " ")
-			metricName = fields[2]
-			if strings.HasPrefix(metricName, "go_") || strings.HasPrefix(metricName, "process_") || strings.HasPrefix(metricName, "promhttp_") {
-				skipMetric = true
-				log.Infof("line %vff: Skipping prometheus-internal metric %q", lineno, metricName)
-			} else {
-				skipMetric = false
-			}
-			if skipMetric {
+		// Skip predefined prometheus-internal metrics unless asked to keep
+		// them, and whatever the filter excludes
+		if !filter.keepInternal && isInternalMetric(metricName) {
+			log.Infof("line %v: Skipping prometheus-internal metric %q", family.line+1, metricName)
+			continue
+		}
+		if !filter.keepMetric(metricName) {
+			log.Debugf("line %v: Skipping metric %q excluded by name", family.line+1, metricName)
+			continue
+		}
+		var samples []*dto.Metric
+		for _, sample := range family.metrics {
+			if !filter.keepItem(sampleLabels(sample)) {
 				continue
 			}
-			mHelp := strings.Join(fields[3:], " ")
-
-			m := Metric{
-				Name: metricName,
-				Help: mHelp,
-			}
-			err := c.AddMetric(m)
-			if err != nil {
-				return nil, fmt.Errorf("line %v: %v", lineno, err)
-			}
-		} else if strings.HasPrefix(line, "# TYPE") {
-			// line e.g. '# TYPE libvirt_domain_block_meta gauge'
-			if !expectType {
-				return nil, fmt.Errorf("line %v: Unexpected 'TYPE' (not preceded by 'HELP')", lineno)
-			}
-
-			expectType = false
-			expectMetric = true
-			expectHelp = true
-
-			fields := strings.Split(line, " ")
-
-			if fields[2] != metricName {
-				return nil, fmt.Errorf("line %v: Out-of-order line '%v' (expecting 'TYPE %v ...')", lineno, line, metricName)
-			}
-			if skipMetric {
+			// A configuration cannot hold these in every format (e.g. json)
+			if value := sampleValue(sample); math.IsNaN(value) || math.IsInf(value, 0) {
+				log.Infof("metric %q: Skipping metric item %v with value %v", metricName, sampleLabels(sample), value)
 				continue
 			}
-			mType := fields[3]
-			if m, ok := c.GetMetric(metricName); ok {
-				m.Type = mType
-			} else {
-				return nil, fmt.Errorf("line %v: Metric %q unknown", lineno, metricName)
-			}
-		} else {
-			// line e.g. 'libvirt_domain_block_meta{bus="scsi",cache="writeback",discard="unmap",disk_type="network",domain="instance-0000bfa6",driver_type="raw",flavor="m1.small",instance_name="zabbix-prod",project_name="C00061-Nexible",project_uuid="077224dcfd454436987147de7d86fa89",root_type="image",root_uuid="fd8ad5aa-6b33-4198-a05d-8be42fc0f20e",serial="",source_file="ephemeral-vms/ed1ce34e-0200-4f2e-a0cc-2b60216e1362_disk",target_device="sda",user_name="OSieben@nexible.de",user_uuid="02a474d230b04749b882362909c79502",uuid="ed1ce34e-0200-4f2e-a0cc-2b60216e1362"} 1'
-			if !expectMetric {
-				return nil, fmt.Errorf("line %v: Unexpected '%v' (not preceded by 'HELP')", lineno, line)
-			}
+			samples = append(samples, sample)
+		}
+		if len(samples) == 0 && len(family.metrics) > 0 {
+			log.Debugf("line %v: Skipping metric %q without items to convert", family.line+1, metricName)
+			continue
+		}
+		m := &Metric{
+			Name: metricName,
+			Help: family.help,
+			Type: family.metricType,
+			Unit: family.unit,
+		}
+		err := c.AddMetric(m)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", family.line+1, err)
+		}
+		assumedAge := false
+
+		for _, sample := range samples {
+			value := sampleValue(sample)
+			settings := rules.settings(metricName, sampleLabels(sample), fallback(metricName))
+
+			// correctness asserted in ScrapefileToCollection(...) and by
+			// the validation of the rules
+			f, _ := randomFunc(settings.function)
+			d, _ := randomDuration(settings.interval)
+
+			// Histograms and summaries are observed with the distribution
+			// and rate of the scrape
+			if sample.Histogram != nil || sample.Summary != nil {
+				item := &MetricItem{
+					Func:     f,
+					Interval: d,
+					Labels:   sampleLabels(sample),
+				}
+				var count float64
+				if sample.Histogram != nil {
+					m.Buckets, item.Distribution = histogramDistribution(sample.Histogram)
+					count = float64(sample.Histogram.GetSampleCount())
+				} else {
+					m.Quantiles, item.Distribution = summaryDistribution(sample.Summary)
+					count = float64(sample.Summary.GetSampleCount())
+				}
+				if n := len(item.Distribution); n > 0 {
+					item.Min, item.Max = item.Distribution[0].Value, item.Distribution[n-1].Value
+				}
 
-			expectType = false
-			expectHelp = true
-			expectMetric = true
+				// A gauge histogram is replaced on every refresh, its count
+				// is no rate
+				start := startOf(metricName, item.Labels)
+				if m.Type != "gaugehistogram" && start > 0 && now > start {
+					item.Rate = count / (now - start)
+				}
 
-			if skipMetric {
-				continue
-			}
-			matchMap := createMatchMap(regexpMetricItem, line)
-			if len(matchMap) == 0 {
-				log.Infof("line %v: Skipping unparsable metric item '%v' (must match regex '%v')", lineno, line, regexpMetricItem)
-				continue
-			}
-			if matchMap["name"] != metricName {
-				log.Infof("line %v: Skipping out-of-order line '%v' (expecting '%v ...')", lineno, line, metricName)
+				if _, ok := m.GetItem(item.Labels); ok {
+					log.Infof("metric %q: Skipping duplicate metric item %v", metricName, item.Labels)
+					continue
+				}
+				if err := m.AddItem(item); err != nil {
+					return nil, fmt.Errorf("line %v: metric %q: %v", family.line+1, metricName, err)
+				}
 				continue
 			}
 
-			m, ok := c.GetMetric(metricName)
-			if !ok {
-				return nil, fmt.Errorf("line %v: Metric %q unknown", lineno, metricName)
-			}
-
-			value, err := strconv.ParseFloat(matchMap["value"], 64)
-			if err != nil {
-				log.Infof("line %v: Skipping metric item %q (cannot parse value %q)", lineno, line, matchMap["value"])
+			// A counter starts at its scraped total and increases by the
+			// average rate since its start (or that per refresh)
+			if m.Type == "counter" && value >= 0 {
+				age := defaultCounterAge.Seconds()
+				if start := startOf(metricName, sampleLabels(sample)); start > 0 && now > start {
+					age = now - start
+				} else if !assumedAge {
+					log.Infof("metric %q: No start time, assuming the counter counted for %v", metricName, defaultCounterAge)
+					assumedAge = true
+				}
+				min, max := settings.deviate(value / age)
+				min, max = math.Max(0, min), math.Max(0, max)
+				if settings.mode == "increment" {
+					min, max = min*DefaultRefresh.Seconds(), max*DefaultRefresh.Seconds()
+				}
+				item := &MetricItem{
+					Min:      min,
+					Max:      max,
+					Func:     f,
+					Interval: d,
+					Labels:   sampleLabels(sample),
+					Initial:  value,
+					Mode:     settings.mode,
+				}
+				if _, ok := m.GetItem(item.Labels); ok {
+					log.Infof("metric %q: Skipping duplicate metric item %v", metricName, item.Labels)
+					continue
+				}
+				if err := m.AddItem(item); err != nil {
+					return nil, fmt.Errorf("line %v: metric %q: %v", family.line+1, metricName, err)
+				}
 				continue
 			}
 
-			// correctness asserted in ScrapefileToCollection(...)
-			f, _ := randomFunc(function)
-			d, _ := randomDuration(interval)
+			min, max := settings.deviate(value)
 
-			var min, max float64
-			if isPercent(metricName, honorpct) {
-				min = math.Max(0, value-float64(maxdeviation))
-				max = math.Min(100, value+float64(maxdeviation))
-			} else {
-				min, max = randomRange(value, maxdeviation)
-			}
-
-			item := MetricItem{
+			item := &MetricItem{
 				Min:      min,
 				Max:      max,
 				Func:     f,
 				Interval: d,
+				Labels:   sampleLabels(sample),
 			}
 
-			if matchMap["labels"] != "" {
-				labels := make(map[string]string)
-				for _, labelKv := range strings.Split(matchMap["labels"], ",") {
-					kv := strings.Split(labelKv, "=")
-					labels[stripQuotes(kv[0])] = stripQuotes(kv[1])
+			switch m.Type {
+			case "info":
+				item.Min, item.Max = 1, 1
+			case "stateset":
+				// Each state is a separate sample. The state is the label
+				// named like the metric, the value tells whether the state is
+				// active.
+				state, ok := item.Labels[metricName]
+				if !ok {
+					log.Infof("metric %q: Skipping stateset sample without state label %v", metricName, item.Labels)
+					continue
+				}
+				delete(item.Labels, metricName)
+				if len(item.Labels) == 0 {
+					item.Labels = nil
+				}
+				if !isInSlice(state, m.States) {
+					m.States = append(m.States, state)
+				}
+				index := float64(len(m.States) - 1)
+				for k := range m.States {
+					if m.States[k] == state {
+						index = float64(k)
+					}
 				}
-				item.Labels = labels
+				if existing, ok := m.GetItem(item.Labels); ok {
+					if value == 1 {
+						existing.Min, existing.Max = index, index
+					}
+					continue
+				}
+				if value == 1 {
+					item.Min, item.Max = index, index
+				} else {
+					item.Min, item.Max = 0, 0
+				}
+			}
+
+			if _, ok := m.GetItem(item.Labels); ok {
+				log.Infof("metric %q: Skipping duplicate metric item %v", metricName, item.Labels)
+				continue
 			}
 			if err := m.AddItem(item); err != nil {
-				return nil, fmt.Errorf("line %v: %v", lineno, err)
+				return nil, fmt.Errorf("line %v: metric %q: %v", family.line+1, metricName, err)
 			}
 		}
 	}
@@ -192,7 +293,7 @@ func convertScrapeToConfig(scrapeLines *[]string, maxdeviation int, function str
 func isPercent(metricName string, honorpct string) bool {
 	s := strings.Split(honorpct, ",")
 	for _, sub := range s {
-		if strings.Contains(metricName, sub) {
+		if sub != "" && strings.Contains(metricName, sub) {
 			return true
 		}
 	}
@@ -247,6 +348,14 @@ func randomRange(value float64, maxDeviation int) (min float64, max float64) {
 }
 
 func ScrapefileToCollection(filename string, maxdeviation int, function string, interval string, honorpct string) (*Collection, error) {
+	return ScrapeToCollection(filename, FetchOptions{}, ConvertFilter{}, nil, maxdeviation, function, interval, honorpct)
+}
+
+// Like ScrapefileToCollection, but source can also be the http(s) URL of an
+// exporter which is fetched with the given options. Only the metrics and
+// items selected by filter are converted. The first matching rule (if any)
+// overrides maxdeviation, function, interval and honorpct.
+func ScrapeToCollection(source string, fetch FetchOptions, filter ConvertFilter, rules *ConvertRules, maxdeviation int, function string, interval string, honorpct string) (*Collection, error) {
 
 	// Assert correctness of input parameters
 	_, err := randomFunc(function)
@@ -257,13 +366,29 @@ func ScrapefileToCollection(filename string, maxdeviation int, function string,
 	if err != nil {
 		return nil, err
 	}
+	if !IsValidScrapeFormat(fetch.Format) {
+		return nil, fmt.Errorf("unknown scrape format %q", fetch.Format)
+	}
+	_, err = filter.compile()
+	if err != nil {
+		return nil, err
+	}
+	err = rules.Validate()
+	if err != nil {
+		return nil, err
+	}
 
-	scrapeLines, err := readLines(filename)
+	var scrapeLines *[]string
+	if isURL(source) {
+		scrapeLines, err = fetchLines(source, fetch)
+	} else {
+		scrapeLines, err = readLines(source)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	collection, err := convertScrapeToConfig(scrapeLines, maxdeviation, function, interval, honorpct)
+	collection, err := convertScrapeToConfig(scrapeLines, fetch.Format, filter, rules, maxdeviation, function, interval, honorpct)
 	if err != nil {
 		return nil, err
 	}
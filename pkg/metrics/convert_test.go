@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -99,7 +100,7 @@ func Test_convertScrapeToConfig(t *testing.T) {
 				`my_metric{foo="lion",instance="aaa"} 1`,
 				`my_metric{foo="lion",instance="bbb"} 2`},
 			},
-			wantErr: true,
+			wantErr: false,
 		},
 		{
 			name: "Internal metric",
@@ -137,7 +138,7 @@ func Test_convertScrapeToConfig(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "Metrics with name other than announced in HELP or TYPE are dropped",
+			name: "Metrics with name other than announced in HELP or TYPE are untyped",
 			args: args{scrapeLines: &[]string{
 				`# HELP my_metric This is a metric`,
 				`# TYPE my_metric gauge`,
@@ -177,6 +178,16 @@ func Test_convertScrapeToConfig(t *testing.T) {
 			//},
 			wantErr: false,
 		},
+		{
+			name: "Duplicate metric items are dropped",
+			args: args{scrapeLines: &[]string{
+				`# HELP my_metric This is a metric`,
+				`# TYPE my_metric gauge`,
+				`my_metric{foo="lion",instance="aaa"} 1`,
+				`my_metric{instance="aaa",foo="lion"} 2`},
+			},
+			wantErr: false,
+		},
 		{
 			name: "Metrics without value are dropped",
 			args: args{scrapeLines: &[]string{
@@ -211,7 +222,7 @@ func Test_convertScrapeToConfig(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := convertScrapeToConfig(tt.args.scrapeLines, 10, "rand", "1s-1s", "percent")
+			got, err := convertScrapeToConfig(tt.args.scrapeLines, "", ConvertFilter{}, nil, 10, "rand", "1s-1s", "percent")
 			if err != nil {
 				if !tt.wantErr {
 					t.Errorf("convertScrapeToConfig() error = %v, wantErr %v", err, tt.wantErr)
@@ -225,50 +236,6 @@ func Test_convertScrapeToConfig(t *testing.T) {
 	}
 }
 
-func Test_stripQuotes(t *testing.T) {
-	type args struct {
-		s string
-	}
-	tests := []struct {
-		name string
-		args args
-		want string
-	}{
-		{
-			name: "Empty in, empty out",
-			args: args{s: ""},
-			want: "",
-		},
-		{
-			name: "Single quote",
-			args: args{s: `"`},
-			want: "",
-		},
-		{
-			name: "Only opening quote",
-			args: args{s: `"test`},
-			want: "test",
-		},
-		{
-			name: "Only closing quote",
-			args: args{s: `test"`},
-			want: "test",
-		},
-		{
-			name: "Enclosing quotes",
-			args: args{s: `"test"`},
-			want: "test",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := stripQuotes(tt.args.s); got != tt.want {
-				t.Errorf("stripQuotes() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 //func Test_ConvertScrapefileToYaml(t *testing.T) {
 //	type args struct {
 //		filename  string
@@ -560,6 +527,14 @@ func Test_isPercent(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "empty",
+			args: args{
+				metricName: "foo_met",
+				honorpct:   "",
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -660,3 +635,203 @@ func Test_ScrapefileToCollection(t *testing.T) {
 		})
 	}
 }
+
+func Test_convertScrapeToConfig_openMetricsTypes(t *testing.T) {
+	scrapeLines := &[]string{
+		`# HELP build Build information`,
+		`# TYPE build info`,
+		`build_info{version="1.0"} 1`,
+		`# HELP door Door state`,
+		`# TYPE door stateset`,
+		`door{door="open",room="a"} 0`,
+		`door{door="closed",room="a"} 1`,
+		`# HELP disk_read Disk read time`,
+		`# TYPE disk_read untyped`,
+		`# UNIT disk_read seconds`,
+		`disk_read 3`,
+	}
+	got, err := convertScrapeToConfig(scrapeLines, "", ConvertFilter{}, nil, 10, "rand", "1s-1s", "percent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build, ok := got.GetMetric("build")
+	if !ok || len(build.Items) != 1 || build.Items[0].Min != 1 || build.Items[0].Max != 1 {
+		t.Errorf("info metric = %+v, want one item with value 1", build)
+	}
+
+	door, ok := got.GetMetric("door")
+	if !ok {
+		t.Fatal("stateset metric door missing")
+	}
+	if !reflect.DeepEqual(door.States, []string{"open", "closed"}) {
+		t.Errorf("States = %v, want [open closed]", door.States)
+	}
+	if !reflect.DeepEqual(door.Labels, []string{"room"}) {
+		t.Errorf("Labels = %v, want [room]", door.Labels)
+	}
+	if len(door.Items) != 1 || door.Items[0].Min != 1 || door.Items[0].Max != 1 {
+		t.Errorf("Items = %+v, want one item with state index 1", door.Items)
+	}
+
+	diskRead, ok := got.GetMetric("disk_read")
+	if !ok || diskRead.Unit != "seconds" {
+		t.Errorf("untyped metric = %+v, want unit seconds", diskRead)
+	}
+}
+
+func Test_convertScrapeToConfig_exposition(t *testing.T) {
+	scrapeLines := &[]string{
+		`# HELP http_requests_total Requests with "escaped" \\ help`,
+		`# TYPE http_requests_total counter`,
+		`http_requests_total{path="/a,b",query="x=1",agent="say \"hi\""} 10 1649759597692`,
+		`# A comment`,
+		`# HELP temperature Temperature`,
+		`# TYPE temperature gauge`,
+		`temperature{sensor="nan"} NaN`,
+		`temperature{sensor="hot"} +Inf`,
+		`temperature{sensor="cold"} -Inf`,
+		`temperature{sensor="room"} 21`,
+	}
+	got, err := convertScrapeToConfig(scrapeLines, "", ConvertFilter{}, nil, 10, "rand", "15s-15s", "percent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests, ok := got.GetMetric("http_requests_total")
+	if !ok {
+		t.Fatal("metric http_requests_total missing")
+	}
+	if requests.Help != `Requests with "escaped" \ help` {
+		t.Errorf("Help = %q", requests.Help)
+	}
+	wantLabels := map[string]string{"path": "/a,b", "query": "x=1", "agent": `say "hi"`}
+	if len(requests.Items) != 1 || !reflect.DeepEqual(requests.Items[0].Labels, wantLabels) {
+		t.Errorf("Items = %+v, want labels %v", requests.Items, wantLabels)
+	}
+
+	// Special values are skipped, a configuration cannot hold them in every
+	// format
+	temperature, ok := got.GetMetric("temperature")
+	if !ok || len(temperature.Items) != 1 || temperature.Items[0].Labels["sensor"] != "room" {
+		t.Fatalf("temperature = %+v, want only the item of sensor room", temperature)
+	}
+	if _, err := got.Marshal("json"); err != nil {
+		t.Errorf("Marshal() error = %v", err)
+	}
+
+	// Metrics are in the order of the scrape
+	if got.Metrics[0].Name != "http_requests_total" || got.Metrics[1].Name != "temperature" {
+		t.Errorf("Metrics = %v, %v, want http_requests_total, temperature", got.Metrics[0].Name, got.Metrics[1].Name)
+	}
+}
+
+func Test_convertScrapeToConfig_histogramsAndSummaries(t *testing.T) {
+	start := time.Now().Add(-100 * time.Second).Unix()
+	scrapeLines := &[]string{
+		`# HELP process_start_time_seconds Start time of the process`,
+		`# TYPE process_start_time_seconds gauge`,
+		fmt.Sprintf(`process_start_time_seconds %v`, start),
+		`# HELP request_duration_seconds Request duration`,
+		`# TYPE request_duration_seconds histogram`,
+		`request_duration_seconds_bucket{code="200",le="0.1"} 500`,
+		`request_duration_seconds_bucket{code="200",le="1"} 900`,
+		`request_duration_seconds_bucket{code="200",le="+Inf"} 1000`,
+		`request_duration_seconds_sum{code="200"} 150`,
+		`request_duration_seconds_count{code="200"} 1000`,
+		`# HELP response_size_bytes Response size`,
+		`# TYPE response_size_bytes summary`,
+		`response_size_bytes{quantile="0.5"} 100`,
+		`response_size_bytes{quantile="0.9"} 500`,
+		`response_size_bytes_sum 30000`,
+		`response_size_bytes_count 200`,
+	}
+	got, err := convertScrapeToConfig(scrapeLines, "", ConvertFilter{}, nil, 10, "rand", "15s-15s", "percent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := got.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	histogram, ok := got.GetMetric("request_duration_seconds")
+	if !ok || len(histogram.Items) != 1 {
+		t.Fatalf("histogram = %+v, want one item", histogram)
+	}
+	if !reflect.DeepEqual(histogram.Buckets, []float64{0.1, 1}) {
+		t.Errorf("Buckets = %v, want [0.1 1]", histogram.Buckets)
+	}
+	item := histogram.Items[0]
+	wantDistribution := []Quantile{{0, 0}, {0.5, 0.1}, {0.9, 1}, {1, 1.9}}
+	if !reflect.DeepEqual(item.Distribution, wantDistribution) {
+		t.Errorf("Distribution = %v, want %v", item.Distribution, wantDistribution)
+	}
+	if item.Min != 0 || item.Max != 1.9 || !reflect.DeepEqual(item.Labels, map[string]string{"code": "200"}) {
+		t.Errorf("item = %+v, want min 0, max 1.9, code 200", item)
+	}
+	// 1000 observations since the process started 100s ago
+	if item.Rate < 9.5 || item.Rate > 10 {
+		t.Errorf("Rate = %v, want about 10", item.Rate)
+	}
+
+	summary, ok := got.GetMetric("response_size_bytes")
+	if !ok || len(summary.Items) != 1 {
+		t.Fatalf("summary = %+v, want one item", summary)
+	}
+	if !reflect.DeepEqual(summary.Quantiles, []float64{0.5, 0.9}) {
+		t.Errorf("Quantiles = %v, want [0.5 0.9]", summary.Quantiles)
+	}
+	wantDistribution = []Quantile{{0, 0}, {0.5, 100}, {0.9, 500}, {1, 600}}
+	if !reflect.DeepEqual(summary.Items[0].Distribution, wantDistribution) {
+		t.Errorf("Distribution = %v, want %v", summary.Items[0].Distribution, wantDistribution)
+	}
+}
+
+func Test_convertScrapeToConfig_counters(t *testing.T) {
+	start := time.Now().Add(-100 * time.Second).Unix()
+	scrapeLines := &[]string{
+		`# HELP process_start_time_seconds Start time of the process`,
+		`# TYPE process_start_time_seconds gauge`,
+		fmt.Sprintf(`process_start_time_seconds %v`, start),
+		`# HELP requests_total Requests`,
+		`# TYPE requests_total counter`,
+		`requests_total{code="200"} 1000`,
+		`requests_total{code="500"} 0`,
+	}
+	got, err := convertScrapeToConfig(scrapeLines, "", ConvertFilter{}, nil, 0, "rand", "15s-15s", "percent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := got.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	counter, ok := got.GetMetric("requests_total")
+	if !ok || len(counter.Items) != 2 {
+		t.Fatalf("counter = %+v, want two items", counter)
+	}
+	// 1000 requests since the process started 100s ago
+	item := counter.Items[0]
+	if item.Initial != 1000 || item.Mode != "rate" || item.Min < 9.5 || item.Max > 10 || item.Min != item.Max {
+		t.Errorf("item = %+v, want initial 1000 and rate about 10", item)
+	}
+	item = counter.Items[1]
+	if item.Initial != 0 || item.Mode != "rate" || item.Min != 0 || item.Max != 0 {
+		t.Errorf("item = %+v, want initial 0 and rate 0", item)
+	}
+
+	// Without start time, the counter is assumed to have counted for an hour
+	scrapeLines = &[]string{
+		`# HELP requests_total Requests`,
+		`# TYPE requests_total counter`,
+		`requests_total 7200`,
+	}
+	got, err = convertScrapeToConfig(scrapeLines, "", ConvertFilter{}, nil, 0, "rand", "15s-15s", "percent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item = got.Metrics[0].Items[0]
+	if item.Initial != 7200 || item.Min != 2 || item.Max != 2 {
+		t.Errorf("item = %+v, want initial 7200 and rate 2", item)
+	}
+}
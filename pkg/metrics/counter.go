@@ -0,0 +1,23 @@
+package metrics
+
+import "time"
+
+// The amount by which a counter item increases upon a refresh at elapsed
+// (since the start of the simulation), given the generated value. The
+// first call (since the series appeared, see resetState) includes the
+// initial value.
+func (i *MetricItem) increase(value float64, elapsed time.Duration) float64 {
+	var result float64
+	if !i.started {
+		i.started = true
+		result = i.Initial
+	}
+
+	if i.Mode == "rate" {
+		result += value * (elapsed - i.countedUntil).Seconds()
+	} else {
+		result += value
+	}
+	i.countedUntil = elapsed
+	return result
+}
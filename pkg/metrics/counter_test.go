@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricItem_increase(t *testing.T) {
+	tests := []struct {
+		name  string
+		item  MetricItem
+		value float64
+		want  []float64
+	}{
+		{name: "increment", item: MetricItem{}, value: 2, want: []float64{2, 2, 2}},
+		{name: "increment-initial", item: MetricItem{Initial: 100, Mode: "increment"}, value: 2, want: []float64{102, 2, 2}},
+		{name: "rate", item: MetricItem{Mode: "rate"}, value: 2, want: []float64{30, 30, 60}},
+		{name: "rate-initial", item: MetricItem{Initial: 100, Mode: "rate"}, value: 0.5, want: []float64{107.5, 7.5, 15}},
+	}
+	refreshes := []time.Duration{15 * time.Second, 30 * time.Second, time.Minute}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, elapsed := range refreshes {
+				if got := tt.item.increase(tt.value, elapsed); got != tt.want[k] {
+					t.Errorf("increase() at %v = %v, want %v", elapsed, got, tt.want[k])
+				}
+			}
+		})
+	}
+}
+
+func Test_refreshMetricsCollection_counterLifecycle(t *testing.T) {
+	m := NewMetric("jobs_total", "counter", WithLabels("item"))
+	for _, item := range []*MetricItem{
+		NewItem(1, 1, WithMode("rate"), WithLifetime(time.Hour, 0), WithLabelValues(map[string]string{"item": "start"})),
+		NewItem(1, 1, WithMode("rate"), WithInitial(100), WithAbsence(10*time.Minute, 5*time.Minute), WithLabelValues(map[string]string{"item": "absence"})),
+	} {
+		if err := m.AddItem(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewCollection()
+	if err := c.AddMetric(m); err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	if err := c.register(registry); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		elapsed time.Duration
+		want    map[string]float64
+	}{
+		{elapsed: 0, want: map[string]float64{"absence": 100}},
+		{elapsed: 4 * time.Minute, want: map[string]float64{"absence": 340}},
+		{elapsed: 6 * time.Minute, want: map[string]float64{}},
+		// The counter starts over at its initial value when it reappears
+		// at 10m
+		{elapsed: 12 * time.Minute, want: map[string]float64{"absence": 220}},
+		// The item which starts at 1h did not count before
+		{elapsed: time.Hour, want: map[string]float64{"start": 0, "absence": 100}},
+		{elapsed: time.Hour + time.Minute, want: map[string]float64{"start": 60, "absence": 160}},
+	}
+	for _, step := range steps {
+		if err := refreshMetricsCollectionAt(c, step.elapsed); err != nil {
+			t.Fatal(err)
+		}
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]float64)
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				got[metric.GetLabel()[0].GetValue()] = metric.GetCounter().GetValue()
+			}
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("counters at %v = %v, want %v", step.elapsed, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Most observations of an item per refresh
+const maxObservations = 100000
+
+// A point of a distribution: the fraction "quantile" of all observations is
+// less than or equal to value
+type Quantile struct {
+	Quantile float64 `yaml:"quantile"`
+	Value    float64 `yaml:"value"`
+}
+
+// The value at quantile q (0-1) of a distribution, interpolated linearly
+// between its points
+func quantileValue(distribution []Quantile, q float64) float64 {
+	k := sort.Search(len(distribution), func(k int) bool { return distribution[k].Quantile >= q })
+	if k == 0 {
+		return distribution[0].Value
+	}
+	if k == len(distribution) {
+		return distribution[k-1].Value
+	}
+	lower, upper := distribution[k-1], distribution[k]
+	return lower.Value + (upper.Value-lower.Value)*(q-lower.Quantile)/(upper.Quantile-lower.Quantile)
+}
+
+// Number of observations of a histogram or summary item up to elapsed (since
+// the start of the simulation), counted from the previous call or from when
+// the series appeared (see resetState)
+func (i *MetricItem) observationCount(elapsed time.Duration) int {
+	if i.Rate <= 0 {
+		return 1
+	}
+	pending := i.pendingObservations + i.Rate*(elapsed-i.observedUntil).Seconds()
+	i.observedUntil = elapsed
+	count := math.Floor(pending)
+	i.pendingObservations = pending - count
+	if count > maxObservations {
+		count = maxObservations
+	}
+	return int(count)
+}
+
+// The value of an observation of a histogram or summary item
+func (i *MetricItem) observation(elapsed time.Duration) float64 {
+	if len(i.Distribution) > 0 {
+		return quantileValue(i.Distribution, rand.Float64())
+	}
+	value, _ := i.ValueAt(elapsed)
+	return value
+}
+
+// Bucket boundaries and distribution of a histogram sample. The lower bound
+// of the first bucket is 0 (or extrapolated if the bound is not positive), the
+// upper bound of the +Inf bucket is extrapolated from the last two buckets.
+func histogramDistribution(h *dto.Histogram) ([]float64, []Quantile) {
+	var bounds []float64
+	var cumulative []float64
+	for _, b := range h.Bucket {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		bounds = append(bounds, b.GetUpperBound())
+		cumulative = append(cumulative, float64(b.GetCumulativeCount()))
+	}
+	count := float64(h.GetSampleCount())
+	if len(bounds) == 0 || count == 0 {
+		return bounds, nil
+	}
+
+	// Width of the first and last bucket
+	first, last := math.Abs(bounds[0]), math.Abs(bounds[0])
+	if n := len(bounds); n > 1 {
+		first, last = bounds[1]-bounds[0], bounds[n-1]-bounds[n-2]
+	}
+	lower := 0.0
+	if bounds[0] <= 0 {
+		lower = bounds[0] - first
+	}
+
+	distribution := []Quantile{{Quantile: 0, Value: lower}}
+	for k, bound := range bounds {
+		distribution = append(distribution, Quantile{Quantile: cumulative[k] / count, Value: bound})
+	}
+	if cumulative[len(cumulative)-1] < count {
+		distribution = append(distribution, Quantile{Quantile: 1, Value: bounds[len(bounds)-1] + last})
+	}
+	return bounds, distribution
+}
+
+// Quantiles and distribution of a summary sample. Quantiles 0 and 1 are
+// extrapolated from the nearest two quantiles unless present, but do not cross
+// zero if the values do not.
+func summaryDistribution(s *dto.Summary) ([]float64, []Quantile) {
+	var quantiles []float64
+	var distribution []Quantile
+	for _, q := range s.Quantile {
+		quantiles = append(quantiles, q.GetQuantile())
+		if !math.IsNaN(q.GetValue()) {
+			distribution = append(distribution, Quantile{Quantile: q.GetQuantile(), Value: q.GetValue()})
+		}
+	}
+	if len(distribution) == 0 {
+		return quantiles, nil
+	}
+	sort.Slice(distribution, func(i, j int) bool { return distribution[i].Quantile < distribution[j].Quantile })
+
+	extrapolate := func(a Quantile, b Quantile, q float64) float64 {
+		if a.Quantile == b.Quantile {
+			return a.Value
+		}
+		value := a.Value + (b.Value-a.Value)*(q-a.Quantile)/(b.Quantile-a.Quantile)
+		if a.Value >= 0 && b.Value >= 0 && value < 0 {
+			value = 0
+		}
+		return value
+	}
+	first, last := distribution[0], distribution[len(distribution)-1]
+	if first.Quantile > 0 {
+		next := first
+		if len(distribution) > 1 {
+			next = distribution[1]
+		}
+		distribution = append([]Quantile{{Quantile: 0, Value: extrapolate(first, next, 0)}}, distribution...)
+	}
+	if last.Quantile < 1 {
+		previous := last
+		if len(distribution) > 1 {
+			previous = distribution[len(distribution)-2]
+		}
+		distribution = append(distribution, Quantile{Quantile: 1, Value: extrapolate(previous, last, 1)})
+	}
+	return quantiles, distribution
+}
@@ -0,0 +1,278 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+func Test_quantileValue(t *testing.T) {
+	distribution := []Quantile{{0, 0}, {0.5, 10}, {0.5, 20}, {1, 40}}
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{q: 0, want: 0},
+		{q: 0.25, want: 5},
+		{q: 0.5, want: 10},
+		{q: 0.75, want: 30},
+		{q: 1, want: 40},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.q), func(t *testing.T) {
+			if got := quantileValue(distribution, tt.q); got != tt.want {
+				t.Errorf("quantileValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func histogramSample(count uint64, buckets map[float64]uint64, bounds ...float64) *dto.Histogram {
+	h := &dto.Histogram{SampleCount: proto.Uint64(count)}
+	for _, bound := range bounds {
+		h.Bucket = append(h.Bucket, &dto.Bucket{UpperBound: proto.Float64(bound), CumulativeCount: proto.Uint64(buckets[bound])})
+	}
+	return h
+}
+
+func Test_histogramDistribution(t *testing.T) {
+	tests := []struct {
+		name       string
+		histogram  *dto.Histogram
+		wantBounds []float64
+		want       []Quantile
+	}{
+		{
+			name:       "positive",
+			histogram:  histogramSample(10, map[float64]uint64{1: 2, 2: 8, 4: 10, math.Inf(1): 10}, 1, 2, 4, math.Inf(1)),
+			wantBounds: []float64{1, 2, 4},
+			want:       []Quantile{{0, 0}, {0.2, 1}, {0.8, 2}, {1, 4}},
+		},
+		{
+			name:       "overflow",
+			histogram:  histogramSample(10, map[float64]uint64{1: 5, 2: 5, math.Inf(1): 10}, 1, 2, math.Inf(1)),
+			wantBounds: []float64{1, 2},
+			want:       []Quantile{{0, 0}, {0.5, 1}, {0.5, 2}, {1, 3}},
+		},
+		{
+			name:       "negative",
+			histogram:  histogramSample(4, map[float64]uint64{-1: 2, 1: 4}, -1, 1),
+			wantBounds: []float64{-1, 1},
+			want:       []Quantile{{0, -3}, {0.5, -1}, {1, 1}},
+		},
+		{
+			name:       "empty",
+			histogram:  histogramSample(0, nil, 1, 2),
+			wantBounds: []float64{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bounds, got := histogramDistribution(tt.histogram)
+			if !reflect.DeepEqual(bounds, tt.wantBounds) {
+				t.Errorf("histogramDistribution() bounds = %v, want %v", bounds, tt.wantBounds)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("histogramDistribution() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_summaryDistribution(t *testing.T) {
+	summary := func(quantiles ...float64) *dto.Summary {
+		s := &dto.Summary{SampleCount: proto.Uint64(10)}
+		for k := 0; k < len(quantiles); k += 2 {
+			s.Quantile = append(s.Quantile, &dto.Quantile{Quantile: proto.Float64(quantiles[k]), Value: proto.Float64(quantiles[k+1])})
+		}
+		return s
+	}
+	tests := []struct {
+		name          string
+		summary       *dto.Summary
+		wantQuantiles []float64
+		want          []Quantile
+	}{
+		{
+			name:          "extrapolated",
+			summary:       summary(0.5, 10, 0.75, 20),
+			wantQuantiles: []float64{0.5, 0.75},
+			want:          []Quantile{{0, 0}, {0.5, 10}, {0.75, 20}, {1, 30}},
+		},
+		{
+			name:          "complete",
+			summary:       summary(0, 1, 0.5, 2, 1, 5),
+			wantQuantiles: []float64{0, 0.5, 1},
+			want:          []Quantile{{0, 1}, {0.5, 2}, {1, 5}},
+		},
+		{
+			name:          "single",
+			summary:       summary(0.9, 7),
+			wantQuantiles: []float64{0.9},
+			want:          []Quantile{{0, 7}, {0.9, 7}, {1, 7}},
+		},
+		{
+			name:          "no-observations",
+			summary:       summary(0.5, math.NaN()),
+			wantQuantiles: []float64{0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quantiles, got := summaryDistribution(tt.summary)
+			if !reflect.DeepEqual(quantiles, tt.wantQuantiles) {
+				t.Errorf("summaryDistribution() quantiles = %v, want %v", quantiles, tt.wantQuantiles)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("summaryDistribution() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricItem_observationCount(t *testing.T) {
+	item := NewItem(1, 2)
+	if got := item.observationCount(time.Minute); got != 1 {
+		t.Errorf("observationCount() without rate = %v, want 1", got)
+	}
+
+	item.Rate = 0.4
+	var got []int
+	for _, elapsed := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 8 * time.Second} {
+		got = append(got, item.observationCount(elapsed))
+	}
+	// 0.4, 0.8, 1.2 (1 left 0.2), 2.2
+	if want := []int{0, 0, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("observationCount() = %v, want %v", got, want)
+	}
+}
+
+func Test_refreshMetricsCollection_observations(t *testing.T) {
+	c := NewCollection()
+	histogram := NewMetric("latency_seconds", "histogram", WithBuckets(1, 2))
+	if err := histogram.AddItem(NewItem(0, 2, WithRate(100), WithDistribution(Quantile{0, 0}, Quantile{0.5, 1}, Quantile{1, 2}))); err != nil {
+		t.Fatal(err)
+	}
+	summary := NewMetric("size_bytes", "summary", WithQuantiles(0.5, 0.9))
+	if err := summary.AddItem(NewItem(10, 10)); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []*Metric{histogram, summary} {
+		if err := c.AddMetric(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := c.register(registry); err != nil {
+		t.Fatal(err)
+	}
+	// Pretend the simulation runs for 10s
+	if err := refreshMetricsCollection(c, time.Now().Add(-10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		metric := family.GetMetric()[0]
+		switch family.GetName() {
+		case "latency_seconds":
+			h := metric.GetHistogram()
+			if count := h.GetSampleCount(); count < 1000 || count > 1001 {
+				t.Errorf("histogram count = %v, want 1000 (10s at rate 100)", count)
+			}
+			if len(h.GetBucket()) != 2 || h.GetBucket()[0].GetUpperBound() != 1 {
+				t.Errorf("histogram buckets = %v, want 1, 2", h.GetBucket())
+			}
+			// About half of the observations are below 1
+			if below := float64(h.GetBucket()[0].GetCumulativeCount()) / float64(h.GetSampleCount()); below < 0.4 || below > 0.6 {
+				t.Errorf("fraction of observations <= 1 = %v, want about 0.5", below)
+			}
+		case "size_bytes":
+			s := metric.GetSummary()
+			if s.GetSampleCount() != 1 || len(s.GetQuantile()) != 2 || s.GetQuantile()[0].GetValue() != 10 {
+				t.Errorf("summary = %v, want one observation of 10 with quantiles 0.5, 0.9", s)
+			}
+		}
+	}
+}
+
+func Test_refreshMetricsCollection_observations_lifecycle(t *testing.T) {
+	c := NewCollection()
+	histogram := NewMetric("latency_seconds", "histogram", WithLabels("item"), WithBuckets(1))
+	for _, item := range []*MetricItem{
+		NewItem(1, 1, WithRate(1), WithLifetime(time.Hour, 0), WithLabelValues(map[string]string{"item": "start"})),
+		NewItem(1, 1, WithRate(1), WithAbsence(10*time.Minute, 5*time.Minute), WithLabelValues(map[string]string{"item": "absence"})),
+	} {
+		if err := histogram.AddItem(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	summary := NewMetric("size_bytes", "summary", WithLabels("pod"), WithChurn("pod", 10*time.Minute, 0))
+	if err := summary.AddItem(NewItem(1, 1, WithRate(1), WithLabelValues(map[string]string{"pod": "api"}))); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []*Metric{histogram, summary} {
+		if err := c.AddMetric(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry := prometheus.NewRegistry()
+	if err := c.register(registry); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := func() map[string]uint64 {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := make(map[string]uint64)
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				if family.GetName() == "size_bytes" {
+					result["churn"] = metric.GetSummary().GetSampleCount()
+				} else {
+					result[metric.GetLabel()[0].GetValue()] = metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+		return result
+	}
+
+	steps := []struct {
+		elapsed time.Duration
+		want    map[string]uint64
+	}{
+		{elapsed: 0, want: map[string]uint64{"absence": 0, "churn": 0}},
+		{elapsed: 4 * time.Minute, want: map[string]uint64{"absence": 240, "churn": 240}},
+		{elapsed: 6 * time.Minute, want: map[string]uint64{"churn": 360}},
+		// The absent item counts from its reappearance at 10m, the churned
+		// series from its replacement
+		{elapsed: 12 * time.Minute, want: map[string]uint64{"absence": 120, "churn": 0}},
+		{elapsed: 13 * time.Minute, want: map[string]uint64{"absence": 180, "churn": 60}},
+		// The item which starts at 1h has no observations of the time before
+		{elapsed: time.Hour, want: map[string]uint64{"start": 0, "absence": 0, "churn": 0}},
+		{elapsed: time.Hour + time.Minute, want: map[string]uint64{"start": 60, "absence": 60, "churn": 60}},
+	}
+	for _, step := range steps {
+		if err := refreshMetricsCollectionAt(c, step.elapsed); err != nil {
+			t.Fatal(err)
+		}
+		if got := counts(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("observation counts at %v = %v, want %v", step.elapsed, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// What to render of a simulation
+type RenderOptions struct {
+	// Time since the start of the simulation
+	At time.Duration
+
+	// Time between refreshes like in serve. The collection is refreshed in
+	// these steps up to At, so that counters and histograms accumulate like
+	// when served. 0 evaluates the items only once, at At.
+	Refresh time.Duration
+
+	// Format of the exposition, ScrapeFormatPrometheus (the default) or
+	// ScrapeFormatOpenMetrics
+	Format string
+}
+
+// Write the exposition which serving the collection would yield at the given
+// time since the start, without the metrics of the prometheus go client. The
+// same code as for serving generates the values, i.e. the collection must
+// not be served and can be rendered only once. Func "rand" and churn use
+// math/rand, seed it for a reproducible result.
+func (c *Collection) RenderExposition(w io.Writer, o RenderOptions) error {
+	if o.At < 0 {
+		return fmt.Errorf("invalid time %v. Must not be negative", o.At)
+	}
+	if o.Refresh < 0 {
+		return fmt.Errorf("invalid refresh %v. Must not be negative", o.Refresh)
+	}
+	var format expfmt.Format
+	switch o.Format {
+	case "", ScrapeFormatPrometheus:
+		format = expfmt.FmtText
+	case ScrapeFormatOpenMetrics:
+		format = expfmt.FmtOpenMetrics
+	default:
+		return fmt.Errorf("unknown format %q. Must be one of %v", o.Format, strings.Join([]string{ScrapeFormatPrometheus, ScrapeFormatOpenMetrics}, ", "))
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := c.register(registry); err != nil {
+		return err
+	}
+	if o.Refresh > 0 {
+		for elapsed := time.Duration(0); elapsed < o.At; elapsed += o.Refresh {
+			if err := refreshMetricsCollectionAt(c, elapsed); err != nil {
+				return err
+			}
+		}
+	}
+	if err := refreshMetricsCollectionAt(c, o.At); err != nil {
+		return err
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		return err
+	}
+	encoder := expfmt.NewEncoder(w, format)
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			return err
+		}
+	}
+	if closer, ok := encoder.(expfmt.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
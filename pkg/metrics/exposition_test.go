@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+func TestCollection_RenderExposition(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		options  RenderOptions
+		golden   string
+	}{
+		{
+			name:     "start",
+			filename: "testdata/exposition.yaml",
+			options:  RenderOptions{Refresh: DefaultRefresh},
+			golden:   "testdata/exposition/start.txt",
+		},
+		{
+			name:     "refreshed",
+			filename: "testdata/exposition.yaml",
+			options:  RenderOptions{At: 15 * time.Minute, Refresh: DefaultRefresh},
+			golden:   "testdata/exposition/refreshed.txt",
+		},
+		{
+			name:     "once",
+			filename: "testdata/exposition.yaml",
+			options:  RenderOptions{At: 15 * time.Minute},
+			golden:   "testdata/exposition/once.txt",
+		},
+		{
+			name:     "openmetrics",
+			filename: "testdata/openmetrics_types.yaml",
+			options:  RenderOptions{At: time.Minute, Refresh: DefaultRefresh, Format: ScrapeFormatOpenMetrics},
+			golden:   "testdata/exposition/openmetrics.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := FromYamlFile(tt.filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rand.Seed(1)
+			var got bytes.Buffer
+			if err := c.RenderExposition(&got, tt.options); err != nil {
+				t.Fatal(err)
+			}
+
+			if *update {
+				if err := os.WriteFile(tt.golden, got.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(tt.golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != string(want) {
+				t.Errorf("RenderExposition() =\n%v\nwant\n%v", got.String(), string(want))
+			}
+		})
+	}
+}
+
+func TestCollection_RenderExposition_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options RenderOptions
+		wantErr string
+	}{
+		{name: "negative-time", options: RenderOptions{At: -time.Minute}, wantErr: "invalid time -1m0s"},
+		{name: "negative-refresh", options: RenderOptions{Refresh: -time.Minute}, wantErr: "invalid refresh -1m0s"},
+		{name: "unknown-format", options: RenderOptions{Format: "json"}, wantErr: `unknown format "json"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := FromYamlFile("testdata/exposition.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = c.RenderExposition(&bytes.Buffer{}, tt.options)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("RenderExposition() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// The unit is part of the configuration only. The prometheus go client cannot
+// expose it, so OpenMetrics has no UNIT line and OpenMetrics only types are
+// exposed as their prometheus counterpart.
+func TestCollection_RenderExposition_unit(t *testing.T) {
+	c, err := FromYamlFile("testdata/openmetrics_types.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := c.GetMetric("om_request_size_bytes"); m.Unit != "bytes" {
+		t.Fatalf("unit = %q, want bytes", m.Unit)
+	}
+	data, err := c.Marshal("yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "unit: bytes") {
+		t.Errorf("Marshal() lost the unit:\n%s", data)
+	}
+
+	var got bytes.Buffer
+	if err := c.RenderExposition(&got, RenderOptions{Format: ScrapeFormatOpenMetrics}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got.String(), "# UNIT") {
+		t.Errorf("RenderExposition() has a UNIT line:\n%v", got.String())
+	}
+	for _, line := range []string{"# TYPE om_build_info gauge", "# TYPE om_door gauge"} {
+		if !strings.Contains(got.String(), line) {
+			t.Errorf("RenderExposition() has no line %q:\n%v", line, got.String())
+		}
+	}
+}
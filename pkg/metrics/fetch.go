@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// How to fetch a scrape from an exporter
+type FetchOptions struct {
+	// Format of the scrape, ScrapeFormatPrometheus or ScrapeFormatOpenMetrics.
+	// Empty prefers OpenMetrics and detects the format.
+	Format string
+
+	// Timeout of the whole request, no timeout if 0
+	Timeout time.Duration
+
+	// Basic auth, used if Username is set
+	Username string
+	Password string
+
+	// Bearer token, read from BearerTokenFile if set
+	BearerToken     string
+	BearerTokenFile string
+
+	// TLS settings. CAFile replaces the system CAs. CertFile and KeyFile
+	// present a client certificate.
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// Whether source refers to an exporter instead of a file
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// Build the http client for the options
+func (o FetchOptions) client() (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.CAFile != "" {
+		ca, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %v", o.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Timeout: o.Timeout, Transport: transport}, nil
+}
+
+// Fetch the scrape of an exporter
+func fetchLines(url string, o FetchOptions) (*[]string, error) {
+	client, err := o.client()
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", scrapeAcceptHeaders[o.Format])
+	if o.Username != "" {
+		request.SetBasicAuth(o.Username, o.Password)
+	}
+	token := o.BearerToken
+	if o.BearerTokenFile != "" {
+		data, err := os.ReadFile(o.BearerTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %v: %v", url, response.Status)
+	}
+
+	result := make([]string, 0)
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		result = append(result, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("GET %v: %v", url, err)
+	}
+	return &result, nil
+}
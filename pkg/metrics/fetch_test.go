@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fetchScrape = `# HELP temperature_celsius Temperature
+# TYPE temperature_celsius gauge
+temperature_celsius{room="kitchen"} 21.5
+`
+
+// A stand-in exporter which requires the given Authorization header (if set)
+func exporterHandler(authorization string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != scrapeAcceptHeaders[""] {
+			http.Error(w, "unexpected accept header", http.StatusNotAcceptable)
+			return
+		}
+		if authorization != "" && r.Header.Get("Authorization") != authorization {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(fetchScrape))
+	}
+}
+
+func Test_fetchLines(t *testing.T) {
+	want := &[]string{
+		"# HELP temperature_celsius Temperature",
+		"# TYPE temperature_celsius gauge",
+		`temperature_celsius{room="kitchen"} 21.5`,
+	}
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		opts          FetchOptions
+		wantErr       string
+	}{
+		{name: "plain"},
+		{name: "basic-auth", authorization: "Basic dXNlcjpwYXNz", opts: FetchOptions{Username: "user", Password: "pass"}},
+		{name: "bearer-token", authorization: "Bearer secret", opts: FetchOptions{BearerToken: "secret"}},
+		{name: "bearer-token-file", authorization: "Bearer secret", opts: FetchOptions{BearerTokenFile: tokenFile}},
+		{name: "unauthorized", authorization: "Bearer secret", opts: FetchOptions{BearerToken: "wrong"}, wantErr: "401 Unauthorized"},
+		{name: "missing-token-file", opts: FetchOptions{BearerTokenFile: "no-such-file"}, wantErr: "no such file or directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(exporterHandler(tt.authorization))
+			defer server.Close()
+
+			got, err := fetchLines(server.URL+"/metrics", tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("fetchLines() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetchLines() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("fetchLines() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_fetchLines_tls(t *testing.T) {
+	server := httptest.NewTLSServer(exporterHandler(""))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fetchLines(server.URL, FetchOptions{}); err == nil {
+		t.Errorf("fetchLines() with unknown CA succeeded, want error")
+	}
+	if _, err := fetchLines(server.URL, FetchOptions{InsecureSkipVerify: true}); err != nil {
+		t.Errorf("fetchLines() with insecure-skip-verify error = %v", err)
+	}
+	if _, err := fetchLines(server.URL, FetchOptions{CAFile: caFile}); err != nil {
+		t.Errorf("fetchLines() with CA file error = %v", err)
+	}
+	if _, err := fetchLines(server.URL, FetchOptions{CAFile: "testdata/empty-file.txt"}); err == nil {
+		t.Errorf("fetchLines() with empty CA file succeeded, want error")
+	}
+}
+
+func Test_fetchLines_timeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	_, err := fetchLines(server.URL, FetchOptions{Timeout: 50 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "Timeout") {
+		t.Errorf("fetchLines() error = %v, want timeout", err)
+	}
+}
+
+func TestScrapeToCollection_url(t *testing.T) {
+	server := httptest.NewServer(exporterHandler(""))
+	defer server.Close()
+
+	c, err := ScrapeToCollection(server.URL, FetchOptions{}, ConvertFilter{}, nil, 10, "sin", "15s-1m", "percent")
+	if err != nil {
+		t.Fatalf("ScrapeToCollection() error = %v", err)
+	}
+	m, ok := c.GetMetric("temperature_celsius")
+	if !ok || m.Type != "gauge" || len(m.Items) != 1 || m.Items[0].Labels["room"] != "kitchen" {
+		t.Errorf("ScrapeToCollection() = %+v, want gauge temperature_celsius of kitchen", c.Metrics)
+	}
+}
+
+func Test_fetchLines_accept(t *testing.T) {
+	var accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+	}))
+	defer server.Close()
+
+	for format, want := range scrapeAcceptHeaders {
+		if _, err := fetchLines(server.URL, FetchOptions{Format: format}); err != nil {
+			t.Fatalf("fetchLines() error = %v", err)
+		}
+		if accept != want {
+			t.Errorf("format %q: Accept = %v, want %v", format, accept, want)
+		}
+	}
+}
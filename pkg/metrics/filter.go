@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// A label matcher like code="200", code!="200", code=~"5.." or code!~"5..".
+	// The quotes are optional for values without quotes and operators.
+	regexpLabelMatcher = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*("(?:[^"\\]|\\.)*"|[^"=~!]*?)\s*$`)
+
+	// Name prefixes of the metrics of the prometheus go client
+	internalMetricPrefixes = []string{"go_", "process_", "promhttp_"}
+)
+
+// Which metrics and items of a scrape are converted. The zero value converts
+// everything except the prometheus-internal metrics.
+type ConvertFilter struct {
+	// Regular expressions of metric names to convert. All metrics if empty
+	Include []string
+
+	// Regular expressions of metric names not to convert
+	Exclude []string
+
+	// Label matchers which the items to convert must all satisfy, e.g.
+	// code=~"5..". Like in prometheus, a missing label has an empty value.
+	Matchers []string
+
+	// Also convert the metrics of the prometheus go client (go_*, process_*
+	// and promhttp_*)
+	KeepInternal bool
+}
+
+// The compiled form of a ConvertFilter
+type metricFilter struct {
+	include      []*regexp.Regexp
+	exclude      []*regexp.Regexp
+	matchers     []*labelMatcher
+	keepInternal bool
+}
+
+type labelMatcher struct {
+	name  string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// Compile the regular expressions and matchers of the filter. Name regexes
+// are anchored like in prometheus.
+func (f ConvertFilter) compile() (*metricFilter, error) {
+	result := &metricFilter{keepInternal: f.KeepInternal}
+
+	compileAll := func(exprs []string) ([]*regexp.Regexp, error) {
+		var list []*regexp.Regexp
+		for _, expr := range exprs {
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid metric name regex %q: %v", expr, err)
+			}
+			list = append(list, re)
+		}
+		return list, nil
+	}
+	var err error
+	if result.include, err = compileAll(f.Include); err != nil {
+		return nil, err
+	}
+	if result.exclude, err = compileAll(f.Exclude); err != nil {
+		return nil, err
+	}
+
+	for _, expr := range f.Matchers {
+		matcher, err := parseLabelMatcher(expr)
+		if err != nil {
+			return nil, err
+		}
+		result.matchers = append(result.matchers, matcher)
+	}
+	return result, nil
+}
+
+func parseLabelMatcher(expr string) (*labelMatcher, error) {
+	matches := regexpLabelMatcher.FindStringSubmatch(expr)
+	if matches == nil {
+		return nil, fmt.Errorf("invalid label matcher %q. Must be like name=\"value\", name!=\"value\", name=~\"regex\" or name!~\"regex\"", expr)
+	}
+	result := &labelMatcher{name: matches[1], op: matches[2], value: matches[3]}
+	if strings.HasPrefix(result.value, `"`) {
+		value, err := strconv.Unquote(result.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label matcher %q: %v", expr, err)
+		}
+		result.value = value
+	}
+	if result.op == "=~" || result.op == "!~" {
+		re, err := regexp.Compile("^(?:" + result.value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid label matcher %q: %v", expr, err)
+		}
+		result.re = re
+	}
+	return result, nil
+}
+
+// Whether the matcher is satisfied by the labels
+func (m *labelMatcher) matches(labels map[string]string) bool {
+	value := labels[m.name]
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+// Whether the metric is one of the prometheus go client
+func isInternalMetric(name string) bool {
+	for _, prefix := range internalMetricPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a metric is converted by its name. Internal metrics are not
+// covered here.
+func (f *metricFilter) keepMetric(name string) bool {
+	if len(f.include) > 0 && !matchesAny(name, f.include) {
+		return false
+	}
+	return !matchesAny(name, f.exclude)
+}
+
+// Whether an item is converted by its labels
+func (f *metricFilter) keepItem(labels map[string]string) bool {
+	for _, matcher := range f.matchers {
+		if !matcher.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAny(s string, list []*regexp.Regexp) bool {
+	for _, re := range list {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
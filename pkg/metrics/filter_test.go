@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertFilter(t *testing.T) {
+	scrapeLines := []string{
+		`# HELP go_goroutines Goroutines`,
+		`# TYPE go_goroutines gauge`,
+		`go_goroutines 10`,
+		`# HELP requests_total Requests`,
+		`# TYPE requests_total counter`,
+		`requests_total{code="200",path="/a"} 10`,
+		`requests_total{code="500",path="/a"} 1`,
+		`requests_total{code="503",path="/b"} 1`,
+		`# HELP temperature_celsius Temperature`,
+		`# TYPE temperature_celsius gauge`,
+		`temperature_celsius{room="kitchen"} 20`,
+		`# HELP temperature_max_celsius Maximum temperature`,
+		`# TYPE temperature_max_celsius gauge`,
+		`temperature_max_celsius{room="kitchen"} 25`,
+	}
+	tests := []struct {
+		name    string
+		filter  ConvertFilter
+		want    []string
+		wantErr bool
+	}{
+		{name: "default", filter: ConvertFilter{}, want: []string{"requests_total", "temperature_celsius", "temperature_max_celsius"}},
+		{name: "keep-internal", filter: ConvertFilter{KeepInternal: true}, want: []string{"go_goroutines", "requests_total", "temperature_celsius", "temperature_max_celsius"}},
+		{name: "include", filter: ConvertFilter{Include: []string{"temperature_.*"}}, want: []string{"temperature_celsius", "temperature_max_celsius"}},
+		{name: "include-anchored", filter: ConvertFilter{Include: []string{"temperature"}}, want: nil},
+		{name: "exclude", filter: ConvertFilter{Exclude: []string{".*_max_.*", "requests_total"}}, want: []string{"temperature_celsius"}},
+		{name: "match", filter: ConvertFilter{Matchers: []string{`code=~"5.."`}}, want: []string{"requests_total{code=500,path=/a}", "requests_total{code=503,path=/b}"}},
+		{name: "match-unquoted", filter: ConvertFilter{Matchers: []string{`room=kitchen`}}, want: []string{"temperature_celsius", "temperature_max_celsius"}},
+		{name: "match-several", filter: ConvertFilter{Matchers: []string{`code!="200"`, `path!~"/a"`}}, want: []string{"requests_total{code=503,path=/b}", "temperature_celsius", "temperature_max_celsius"}},
+		{name: "match-missing-label", filter: ConvertFilter{Matchers: []string{`code=""`}}, want: []string{"temperature_celsius", "temperature_max_celsius"}},
+		{name: "invalid-regex", filter: ConvertFilter{Exclude: []string{"("}}, wantErr: true},
+		{name: "invalid-matcher", filter: ConvertFilter{Matchers: []string{`code=="200"`}}, wantErr: true},
+		{name: "invalid-quotes", filter: ConvertFilter{Matchers: []string{`code="200`}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := convertScrapeToConfig(&scrapeLines, "", tt.filter, nil, 10, "rand", "15s-15s", "percent")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convertScrapeToConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var got []string
+			for _, m := range c.Metrics {
+				if m.Name != "requests_total" || len(tt.filter.Matchers) == 0 {
+					got = append(got, m.Name)
+					continue
+				}
+				for _, item := range m.Items {
+					got = append(got, "requests_total{code="+item.Labels["code"]+",path="+item.Labels["path"]+"}")
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("converted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
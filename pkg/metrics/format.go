@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported configuration file formats
+var validFormats = []string{"yaml", "json", "toml"}
+
+// File extensions of the formats
+var formatExtensions = map[string]string{
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".json": "json",
+	".toml": "toml",
+}
+
+// A toml key/value line like 'version = "1"'. Yaml mappings use ":" instead.
+var regexpTomlKeyValue = regexp.MustCompile(`(?m)^\s*[a-zA-Z0-9_"'.-]+\s*=`)
+
+// A toml table header like [metrics.churn] or [[metrics.items]]
+var regexpTomlTable = regexp.MustCompile(`^(\s*)(\[\[?)\s*([^\[\]]+?)\s*\]\]?\s*(?:#.*)?$`)
+
+// The (possibly dotted or quoted) key of a toml key/value line up to the value
+var regexpTomlKey = regexp.MustCompile(`^(\s*)((?:[a-zA-Z0-9_-]+|"[^"]*"|'[^']*')(?:\s*\.\s*(?:[a-zA-Z0-9_-]+|"[^"]*"|'[^']*'))*)\s*=\s*`)
+
+// A part of a dotted toml key
+var regexpTomlKeyPart = regexp.MustCompile(`[a-zA-Z0-9_-]+|"[^"]*"|'[^']*'`)
+
+// Determine the format of a configuration file by its extension or, if that
+// is unknown, by its content
+func detectFormat(filename string, data []byte) string {
+	if format, ok := formatExtensions[strings.ToLower(filepath.Ext(filename))]; ok {
+		return format
+	}
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return "json"
+	}
+	if regexpTomlKeyValue.Match(trimmed) {
+		return "toml"
+	}
+	return "yaml"
+}
+
+// Parse a configuration in the given format into a yaml node tree. Json is a
+// subset of yaml and keeps the positions. Toml is converted, its nodes get the
+// positions of the toml keys and tables.
+func parseConfig(format string, data []byte) (*yaml.Node, error) {
+	var root yaml.Node
+	if format != "toml" {
+		err := yaml.Unmarshal(data, &root)
+		return &root, err
+	}
+
+	var raw map[string]interface{}
+	if err := toml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return &root, nil
+	}
+	converted, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(converted, &root); err != nil {
+		return nil, err
+	}
+	clearPositions(&root)
+	keys, values := tomlPositions(data)
+	setPositions(&root, "", keys, values)
+	return &root, nil
+}
+
+// The positions of the keys and values of a toml document by their path, e.g.
+// "metrics[1].items[0].min". Tables are positioned at their header. Array
+// elements and the keys of inline tables have no position, errors refer to
+// the closest parent. The toml parser keeps no positions, so the lines are
+// scanned.
+func tomlPositions(data []byte) (map[string]Position, map[string]Position) {
+	keys := make(map[string]Position)
+	values := make(map[string]Position)
+
+	// Number of elements of the arrays of tables so far
+	arrays := make(map[string]int)
+	table := ""
+	multiline := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		if multiline != "" {
+			if strings.Count(line, multiline)%2 == 1 {
+				multiline = ""
+			}
+			continue
+		}
+		if matches := regexpTomlTable.FindStringSubmatch(line); matches != nil {
+			pos := Position{Line: i + 1, Column: len(matches[1]) + 1}
+			parts := tomlKeyParts(matches[3])
+			table = ""
+			for k, part := range parts {
+				table = joinPath(table, part)
+				if k == len(parts)-1 && matches[2] == "[[" {
+					if _, ok := values[table]; !ok {
+						keys[table], values[table] = pos, pos
+					}
+					arrays[table]++
+				}
+				if n, ok := arrays[table]; ok {
+					table = fmt.Sprintf("%v[%d]", table, n-1)
+				}
+			}
+			keys[table], values[table] = pos, pos
+			continue
+		}
+		matches := regexpTomlKey.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		path := table
+		for _, part := range tomlKeyParts(matches[2]) {
+			path = joinPath(path, part)
+		}
+		keys[path] = Position{Line: i + 1, Column: len(matches[1]) + 1}
+		values[path] = Position{Line: i + 1, Column: len(matches[0]) + 1}
+		for _, delimiter := range []string{`"""`, `'''`} {
+			if strings.Count(line, delimiter)%2 == 1 {
+				multiline = delimiter
+			}
+		}
+	}
+	return keys, values
+}
+
+// The unquoted parts of a dotted toml key
+func tomlKeyParts(key string) []string {
+	var result []string
+	for _, part := range regexpTomlKeyPart.FindAllString(key, -1) {
+		if part[0] == '"' || part[0] == '\'' {
+			part = part[1 : len(part)-1]
+		}
+		result = append(result, part)
+	}
+	return result
+}
+
+// Position the nodes of a yaml tree by their path, see tomlPositions
+func setPositions(node *yaml.Node, path string, keys map[string]Position, values map[string]Position) {
+	if pos, ok := values[path]; ok {
+		node.Line, node.Column = pos.Line, pos.Column
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			setPositions(child, path, keys, values)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			childPath := joinPath(path, node.Content[i].Value)
+			if pos, ok := keys[childPath]; ok {
+				node.Content[i].Line, node.Content[i].Column = pos.Line, pos.Column
+			}
+			setPositions(node.Content[i+1], childPath, keys, values)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			setPositions(child, fmt.Sprintf("%v[%d]", path, i), keys, values)
+		}
+	}
+}
+
+// Remove the positions of a node tree which was not read from a file as is
+func clearPositions(node *yaml.Node) {
+	node.Line, node.Column = 0, 0
+	for _, child := range node.Content {
+		clearPositions(child)
+	}
+}
+
+// Serialize a collection in one of the supported formats
+func (c *Collection) Marshal(format string) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return nil, err
+	}
+	if format == "yaml" {
+		return buffer.Bytes(), nil
+	}
+
+	// Convert the yaml representation to keep field names and duration format
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(buffer.Bytes(), &raw); err != nil {
+		return nil, err
+	}
+	switch format {
+	case "json":
+		result, err := json.MarshalIndent(raw, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(result, '\n'), nil
+	case "toml":
+		var result bytes.Buffer
+		if err := toml.NewEncoder(&result).Encode(raw); err != nil {
+			return nil, err
+		}
+		return result.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown format %q. Must be one of %v", format, strings.Join(validFormats, ", "))
+}
+
+// Format of a file by its extension, empty if unknown
+func FormatOfFile(filename string) string {
+	return formatExtensions[strings.ToLower(filepath.Ext(filename))]
+}
+
+// Check whether format is a supported configuration format
+func IsValidFormat(format string) bool {
+	return isInSlice(format, validFormats)
+}
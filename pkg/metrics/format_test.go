@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_detectFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		data     string
+		want     string
+	}{
+		{filename: "a.yaml", data: `{"version": "1"}`, want: "yaml"},
+		{filename: "a.YML", data: "", want: "yaml"},
+		{filename: "a.json", data: "version: 1", want: "json"},
+		{filename: "a.toml", data: "", want: "toml"},
+		{filename: "a.conf", data: "  {\n\"version\": \"1\"}", want: "json"},
+		{filename: "a.conf", data: "# comment\nversion = \"1\"", want: "toml"},
+		{filename: "a.conf", data: "[[metrics]]\nname = \"a\"", want: "toml"},
+		{filename: "a.conf", data: "version: \"1\"\nmetrics: []", want: "yaml"},
+		{filename: "a", data: "", want: "yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename+" "+tt.data, func(t *testing.T) {
+			if got := detectFormat(tt.filename, []byte(tt.data)); got != tt.want {
+				t.Errorf("detectFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_FromYamlFile_formats(t *testing.T) {
+	for _, filename := range []string{"testdata/format.json", "testdata/format.toml"} {
+		t.Run(filename, func(t *testing.T) {
+			c, err := FromYamlFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(c.Metrics) != 1 || len(c.Metrics[0].Items) != 1 {
+				t.Fatalf("FromYamlFile() = %+v, want 1 metric with 1 item", c)
+			}
+			item := c.Metrics[0].Items[0]
+			if item.Min != 18 || item.Interval != time.Hour || item.Labels["room"] != "kitchen" {
+				t.Errorf("item = %+v", item)
+			}
+		})
+	}
+}
+
+func TestCollection_Marshal(t *testing.T) {
+	c, err := FromYamlFile("testdata/valid_scrape.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	for _, format := range validFormats {
+		t.Run(format, func(t *testing.T) {
+			data, err := c.Marshal(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// without extension the format must be detected from the content
+			filename := filepath.Join(dir, "config-"+format)
+			if err := os.WriteFile(filename, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := FromYamlFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Metrics) != len(c.Metrics) {
+				t.Fatalf("got %v metrics, want %v", len(got.Metrics), len(c.Metrics))
+			}
+			for i := range c.Metrics {
+				if !reflect.DeepEqual(got.Metrics[i].Items[0].Labels, c.Metrics[i].Items[0].Labels) ||
+					got.Metrics[i].Items[0].Interval != c.Metrics[i].Items[0].Interval ||
+					got.Metrics[i].Items[0].Max != c.Metrics[i].Items[0].Max {
+					t.Errorf("metric %v = %+v, want %+v", i, got.Metrics[i].Items[0], c.Metrics[i].Items[0])
+				}
+			}
+		})
+	}
+
+	if _, err := c.Marshal("xml"); err == nil {
+		t.Errorf("Marshal() error = nil, want error for unknown format")
+	}
+}
+
+func Test_FromYamlFile_formatValidationErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		ext     string
+		content string
+		want    []string
+	}{
+		{
+			name:    "json",
+			ext:     ".json",
+			content: "{\"version\": \"1\", \"metrics\": [\n  {\"name\": \"a\", \"type\": \"foo\", \"items\": [{\"min\": 1, \"max\": 2, \"func\": \"rand\", \"interval\": \"1m\"}]}]}",
+			want:    []string{`2:25: metric "a": unknown type "foo". Must be one of gauge, counter, summary, histogram, info, stateset, gaugehistogram, unknown, untyped`},
+		},
+		{
+			name:    "toml",
+			ext:     ".toml",
+			content: "version = \"1\"\n[[metrics]]\nname = \"a\"\ntype = \"foo\"\n[[metrics.items]]\nmin = 1\nmax = 2\nfunc = \"rand\"\ninterval = \"1m\"",
+			want:    []string{`4:8: metric "a": unknown type "foo". Must be one of gauge, counter, summary, histogram, info, stateset, gaugehistogram, unknown, untyped`},
+		},
+		{
+			name: "toml-nested",
+			ext:  ".toml",
+			content: strings.Join([]string{
+				`version = "1"`,
+				`help = """`,
+				`colour = "not a key"`,
+				`"""`,
+				`[[metrics]]`,
+				`name = "a"`,
+				`type = "gauge"`,
+				`  [[metrics.items]]`,
+				`  min = 1`,
+				`  max = 2`,
+				`  func = "rand"`,
+				`  interval = "1m"`,
+				`[[metrics]]`,
+				`name = "b"`,
+				`type = "gauge"`,
+				`labels = ["room"]`,
+				`  [[metrics.items]]`,
+				`  min = 1`,
+				`  max = 2`,
+				`  func = "rand"`,
+				`  interval = "1m"`,
+				`  labels = { room = "kitchen" }`,
+				`  [[metrics.items]]`,
+				`  min = 1`,
+				`  max = inf`,
+				`  func = "rand"`,
+				`  interval = "1m"`,
+				`  labels.room = "hall"`,
+				`  colour = "red"`,
+			}, "\n"),
+			want: []string{
+				`2:1: unknown field "help"`,
+				`25:9: metric "b" item 1: invalid value +Inf. Must be a finite number`,
+				`29:3: metric "b" item 1: unknown field "colour"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "config"+tt.ext)
+			if err := os.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := FromYamlFile(filename)
+			var validationErrors ValidationErrors
+			if !errors.As(err, &validationErrors) {
+				t.Fatalf("FromYamlFile() error = %v, want ValidationErrors", err)
+			}
+			var got []string
+			for _, e := range validationErrors {
+				e.File = ""
+				got = append(got, e.Error())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromYamlFile() errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,29 +5,80 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Collection struct {
-	Version string    `yaml:"version"`
+	Version string `yaml:"version"`
+
+	// Prefixes of all metric names, see prometheus.BuildFQName
+	Namespace string `yaml:"namespace,omitempty"`
+	Subsystem string `yaml:"subsystem,omitempty"`
+
+	// Labels added to all items of all metrics
+	ConstLabels map[string]string `yaml:"constLabels,omitempty"`
+
 	Metrics []*Metric `yaml:"metrics"`
+
+	// Timelines which change the parameters of items
+	Scenarios []*Scenario `yaml:"scenarios,omitempty"`
+
+	// Set when the collection is being served
+	serving *serving
+}
+
+// State of a served collection
+type serving struct {
+	// Guards changes of metrics and items against a concurrent refresh or
+	// collection
+	mtx sync.Mutex
+
+	// Where the collection is registered, metrics added later are checked
+	// against its collectors
+	registerer prometheus.Registerer
+}
+
+// Lock the collection against a concurrent refresh if it is being served.
+// Returns the unlock function.
+func (c *Collection) lock() func() {
+	if c == nil || c.serving == nil {
+		return func() {}
+	}
+	c.serving.mtx.Lock()
+	return c.serving.mtx.Unlock
 }
 
-func (c *Collection) AddMetric(m Metric) error {
+// Add a metric to the collection. The metric is added as is (not copied),
+// i.e. later changes of m are visible in the collection. The items of m must
+// match its labels. If the collection is being served, the metric is served
+// as well.
+func (c *Collection) AddMetric(m *Metric) error {
 	if m.Name == "" {
 		return fmt.Errorf("metric name is required")
 	}
+	if err := m.checkItems(); err != nil {
+		return fmt.Errorf("metric %q: %v", m.Name, err)
+	}
+	defer c.lock()()
 	if _, ok := c.GetMetric(m.Name); ok {
 		return fmt.Errorf("metric %q already in collection", m.Name)
 	}
-	m.parent = c
-	c.Metrics = append(c.Metrics, &m)
+	if c.serving != nil {
+		if err := c.setupMetric(m, c.serving.registerer); err != nil {
+			return err
+		}
+	}
+	m.link(c)
+	c.Metrics = append(c.Metrics, m)
 	return nil
 }
 
@@ -40,14 +91,48 @@ func (c *Collection) GetMetric(n string) (*Metric, bool) {
 	return nil, false
 }
 
-//func (c *Collection) DeleteMetric(n string) {
-//	for i := range c.Metrics {
-//		if c.Metrics[i].Name == n {
-//			// Reslicing is required to remove an element from a slice
-//			c.Metrics = append(c.Metrics[:i], c.Metrics[i+1:]...)
-//		}
-//	}
-//}
+// Remove the metric with the given name. Returns whether it existed. If the
+// collection is being served, all of its series disappear.
+func (c *Collection) DeleteMetric(name string) bool {
+	defer c.lock()()
+	for i, metric := range c.Metrics {
+		if metric.Name == name {
+			c.unregisterMetric(metric)
+			// Reslicing is required to remove an element from a slice
+			c.Metrics = append(c.Metrics[:i], c.Metrics[i+1:]...)
+			metric.parent = nil
+			return true
+		}
+	}
+	return false
+}
+
+// Replace the metric with the same name by m. The items of m must match its
+// labels. If the collection is being served, m is served instead of the old
+// metric.
+func (c *Collection) ReplaceMetric(m *Metric) error {
+	if err := m.checkItems(); err != nil {
+		return fmt.Errorf("metric %q: %v", m.Name, err)
+	}
+	defer c.lock()()
+	for i, existing := range c.Metrics {
+		if existing.Name != m.Name {
+			continue
+		}
+		if c.serving != nil {
+			if err := c.setupMetric(m, c.serving.registerer); err != nil {
+				return err
+			}
+			c.unregisterMetric(existing)
+		}
+		m.link(c)
+		m.pos = existing.pos
+		c.Metrics[i] = m
+		existing.parent = nil
+		return nil
+	}
+	return fmt.Errorf("metric %q not in collection", m.Name)
+}
 
 /* Abandoned attempt to implement custom unmarshaling
 func (c *Collection) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -104,15 +189,37 @@ func (c *Collection) UnmarshalYAML(unmarshal func(interface{}) error) error {
 */
 
 type Metric struct {
-	Name   string   `yaml:"name"`
-	Help   string   `yaml:"help"`
-	Type   string   `yaml:"type"`
+	Name string `yaml:"name"`
+	Help string `yaml:"help"`
+	Type string `yaml:"type"`
+
+	// OpenMetrics unit, e.g. "seconds". It is kept by convert but not
+	// exposed, the prometheus go client has no units.
+	Unit string `yaml:"unit,omitempty"`
+
 	Labels []string `yaml:"labels"`
 
+	// The possible states of a stateset. The value of an item is the index
+	// of its current state.
+	States []string `yaml:"states,omitempty"`
+
+	// Periodic replacement of a label value of all items
+	Churn *Churn `yaml:"churn,omitempty"`
+
+	// Bucket boundaries of a histogram, the prometheus default buckets if
+	// empty
+	Buckets []float64 `yaml:"buckets,omitempty"`
+
+	// Quantiles exposed by a summary, none if empty
+	Quantiles []float64 `yaml:"quantiles,omitempty"`
+
 	Items []*MetricItem `yaml:"items"`
 
 	parent *Collection
 
+	// where the metric was read from (if at all)
+	pos Position
+
 	// min and max values of all child items
 	//min float64
 	//max float64
@@ -122,43 +229,179 @@ type Metric struct {
 		counter   *prometheus.CounterVec
 		summary   *prometheus.SummaryVec
 		histogram *prometheus.HistogramVec
+		untyped   *untypedVec
+
+		// the registered vector (one of the above)
+		collector prometheus.Collector
 	}
 }
 
-func (m *Metric) AddItem(i MetricItem) error {
+// Label churn, like the pod names of a k8s deployment which change with every
+// restart. The value of the label is regenerated from the item's label value
+// and a random suffix every period and/or with a probability per refresh. The
+// old series is removed and a new one is created.
+type Churn struct {
+	Label       string        `yaml:"label"`
+	Every       time.Duration `yaml:"every,omitempty"`
+	Probability float64       `yaml:"probability,omitempty"`
+}
+
+// Add an item to the metric. The label names of the item must match the
+// labels of the metric. If the metric has neither labels nor items yet, its
+// labels are taken from the item.
+func (m *Metric) AddItem(i *MetricItem) error {
+	defer m.parent.lock()()
+
+	if len(m.Labels) == 0 && len(m.Items) == 0 {
+		m.Labels = labelNames(i.Labels)
+	} else if err := m.checkLabels(i); err != nil {
+		return err
+	}
+
+	if _, ok := m.GetItem(i.Labels); ok {
+		return fmt.Errorf("item with labels %v already in metric", i.Labels)
+	}
 
 	i.parent = m
+	m.Items = append(m.Items, i)
 
-	var labelNames []string
-	for name := range i.Labels {
-		labelNames = append(labelNames, name)
+	return nil
+}
+
+// Remove the item with the given labels. Returns whether it existed. If the
+// metric is being served, the series of the item is deleted.
+func (m *Metric) DeleteItem(labels map[string]string) bool {
+	defer m.parent.lock()()
+	key := labelSetKey(labels)
+	for k, item := range m.Items {
+		if labelSetKey(item.Labels) == key {
+			if m.prometheus.collector != nil {
+				m.deleteSeries(item.seriesLabels())
+			}
+			m.Items = append(m.Items[:k], m.Items[k+1:]...)
+			item.parent = nil
+			return true
+		}
 	}
-	sort.Strings(labelNames)
+	return false
+}
 
-	if m.Labels == nil {
-		m.Labels = labelNames
-	} else {
-		if !stringSlicesEqual(m.Labels, labelNames) {
-			return fmt.Errorf("label mismatch, want %q, got %q", m.Labels, labelNames)
+// Replace the item with the same labels by i. If the metric is being served,
+// the series of the old item is deleted, i.e. i starts with fresh state (like
+// a counter starting at 0).
+func (m *Metric) ReplaceItem(i *MetricItem) error {
+	if err := m.checkLabels(i); err != nil {
+		return err
+	}
+	defer m.parent.lock()()
+	key := labelSetKey(i.Labels)
+	for k, item := range m.Items {
+		if labelSetKey(item.Labels) == key {
+			if m.prometheus.collector != nil {
+				m.deleteSeries(item.seriesLabels())
+			}
+			i.parent = m
+			m.Items[k] = i
+			item.parent = nil
+			return nil
 		}
 	}
+	return fmt.Errorf("no item with labels %v in metric", i.Labels)
+}
 
-	//if i.Min < m.min {
-	//	m.min = i.Min
-	//}
-	//if i.Max > m.max {
-	//	m.max = i.Max
-	//}
+// Change the item with the given labels in place. The labels cannot be
+// changed. Unlike ReplaceItem, a served series keeps its state.
+func (m *Metric) UpdateItem(labels map[string]string, update func(*MetricItem)) error {
+	defer m.parent.lock()()
+	key := labelSetKey(labels)
+	for _, item := range m.Items {
+		if labelSetKey(item.Labels) != key {
+			continue
+		}
+		updated := *item
+		updated.Labels = make(map[string]string, len(item.Labels))
+		for name, value := range item.Labels {
+			updated.Labels[name] = value
+		}
+		update(&updated)
+		if labelSetKey(updated.Labels) != key {
+			return fmt.Errorf("labels of item %v cannot be updated", labels)
+		}
+		*item = updated
+		return nil
+	}
+	return fmt.Errorf("no item with labels %v in metric", labels)
+}
 
-	m.Items = append(m.Items, &i)
+// Check that the label names of an item match the labels of the metric
+func (m *Metric) checkLabels(i *MetricItem) error {
+	sortedLabels := append([]string{}, m.Labels...)
+	sort.Strings(sortedLabels)
+	if names := labelNames(i.Labels); !stringSlicesEqual(sortedLabels, names) {
+		return fmt.Errorf("label mismatch, want %q, got %q", sortedLabels, names)
+	}
+	return nil
+}
 
+// Check that all items match the labels of the metric and are distinct
+func (m *Metric) checkItems() error {
+	labelSets := make(map[string]bool)
+	for _, item := range m.Items {
+		if err := m.checkLabels(item); err != nil {
+			return err
+		}
+		key := labelSetKey(item.Labels)
+		if labelSets[key] {
+			return fmt.Errorf("item with labels %v already in metric", item.Labels)
+		}
+		labelSets[key] = true
+	}
 	return nil
 }
 
+// Set the parent pointers of a metric and its items
+func (m *Metric) link(c *Collection) {
+	m.parent = c
+	for _, item := range m.Items {
+		item.parent = m
+	}
+}
+
+func (m *Metric) GetItem(labels map[string]string) (*MetricItem, bool) {
+	key := labelSetKey(labels)
+	for i := range m.Items {
+		if labelSetKey(m.Items[i].Labels) == key {
+			return m.Items[i], true
+		}
+	}
+	return nil, false
+}
+
 func (m *Metric) ParentCollection() *Collection {
 	return m.parent
 }
 
+// The name of the metric family, i.e. including namespace and subsystem of
+// the parent collection
+func (m *Metric) FullName() string {
+	if m.parent == nil {
+		return m.Name
+	}
+	return prometheus.BuildFQName(m.parent.Namespace, m.parent.Subsystem, m.Name)
+}
+
+// Index of the state of a stateset which corresponds to value
+func (m *Metric) stateIndex(value float64) int {
+	index := int(math.Floor(value))
+	if index < 0 {
+		index = 0
+	}
+	if index > len(m.States)-1 {
+		index = len(m.States) - 1
+	}
+	return index
+}
+
 type MetricItem struct {
 	Min      float64           `yaml:"min"`
 	Max      float64           `yaml:"max"`
@@ -166,33 +409,127 @@ type MetricItem struct {
 	Interval time.Duration     `yaml:"interval"`
 	Labels   map[string]string `yaml:"labels"`
 
+	// Lifecycle relative to the start of the simulation. The item is absent
+	// before start and from end (or start+ttl) on. Zero end and ttl mean
+	// the item never ends.
+	Start   time.Duration `yaml:"start,omitempty"`
+	End     time.Duration `yaml:"end,omitempty"`
+	TTL     time.Duration `yaml:"ttl,omitempty"`
+	Absence *Absence      `yaml:"absence,omitempty"`
+
+	// Observations per second of a histogram or summary. Zero means one
+	// observation per refresh.
+	Rate float64 `yaml:"rate,omitempty"`
+
+	// Distribution of the observations of a histogram or summary. Without
+	// distribution, observations follow func between min and max.
+	Distribution []Quantile `yaml:"distribution,omitempty"`
+
+	// Starting value of a counter, added upon the first refresh
+	Initial float64 `yaml:"initial,omitempty"`
+
+	// How the value of a counter is added: "increment" (the default) adds
+	// the value upon every refresh, "rate" treats the value as increase
+	// per second
+	Mode string `yaml:"mode,omitempty"`
+
 	parent *Metric
+
+	// current value of the churning label and the churn period it belongs to
+	churnValue  string
+	churnPeriod int64
+
+	// time up to which observations were made and the fraction of an
+	// observation left over
+	observedUntil       time.Duration
+	pendingObservations float64
+
+	// whether the initial value of a counter was added and the time up to
+	// which the counter was increased
+	started      bool
+	countedUntil time.Duration
+
+	// whether the item was active upon the previous refresh and since when
+	active      bool
+	activeSince time.Duration
+}
+
+// Start the state accumulated by refreshes over at elapsed, i.e. the item
+// continues like a new one (a counter at its initial value, a histogram
+// without observations)
+func (i *MetricItem) resetState(elapsed time.Duration) {
+	i.started = false
+	i.countedUntil = elapsed
+	i.observedUntil = elapsed
+	i.pendingObservations = 0
+}
+
+// Periodic absence of an item. Within every period (counted from the start
+// of the item) the item is absent for the last "for" duration.
+type Absence struct {
+	Every time.Duration `yaml:"every"`
+	For   time.Duration `yaml:"for"`
 }
 
 func (i *MetricItem) ParentMetric() *Metric {
 	return i.parent
 }
 
+// Whether the item exists at the given time since the start of the simulation
+func (i *MetricItem) isActive(elapsed time.Duration) bool {
+	if elapsed < i.Start {
+		return false
+	}
+	if i.End > 0 && elapsed >= i.End {
+		return false
+	}
+	if i.TTL > 0 && elapsed >= i.Start+i.TTL {
+		return false
+	}
+	if i.Absence != nil && i.Absence.Every > 0 {
+		inPeriod := (elapsed - i.Start) % i.Absence.Every
+		if inPeriod >= i.Absence.Every-i.Absence.For {
+			return false
+		}
+	}
+	return true
+}
+
+// The time since which an active item exists without interruption: its start
+// or the end of its last absence
+func (i *MetricItem) activePeriodStart(elapsed time.Duration) time.Duration {
+	if i.Absence != nil && i.Absence.Every > 0 {
+		return i.Start + (elapsed-i.Start)/i.Absence.Every*i.Absence.Every
+	}
+	return i.Start
+}
+
 // Compute duration since start modulo interval (i.e. the interval repeats endlessly)
 func interval(start time.Time, interval time.Duration) (time.Duration, error) {
-	result := time.Duration(0)
-	passed := int64(time.Since(start))
-	intv := int64(interval)
-	if intv == 0 {
-		return result, fmt.Errorf("interval cannot be 0")
-	}
-	sec := float64(passed % intv)
-	result = time.Duration(sec)
-	return result, nil
+	return elapsedInInterval(time.Since(start), interval)
+}
+
+// Compute elapsed modulo interval
+func elapsedInInterval(elapsed time.Duration, interval time.Duration) (time.Duration, error) {
+	if interval == 0 {
+		return 0, fmt.Errorf("interval cannot be 0")
+	}
+	return elapsed % interval, nil
 }
 
 // Generate a new value upon refresh
 func (i *MetricItem) generateValue(start time.Time) (float64, error) {
+	return i.ValueAt(time.Since(start))
+}
+
+// Compute the value of the item at the given time since the start of the
+// simulation. Func "rand" yields a new random value on every call.
+func (i *MetricItem) ValueAt(elapsed time.Duration) (float64, error) {
 	var result float64
 	if i.Min == i.Max {
 		result = i.Min
 	} else {
-		elapsed, err := interval(start, i.Interval) // elapsed duration in interval
+		elapsed, err := elapsedInInterval(elapsed, i.Interval) // elapsed duration in interval
 		if err != nil {
 			return 0, err
 		}
@@ -220,9 +557,7 @@ func (i *MetricItem) generateValue(start time.Time) (float64, error) {
 			}
 		default:
 			{
-				//return 0, fmt.Errorf("unknown function %q", i.Func)
-				//TODO workaround for missing error flow. Case should be impossible (except when it happens ;) )
-				panic(fmt.Sprintf("unknown function %q", i.Func))
+				return 0, fmt.Errorf("unknown function %q", i.Func)
 			}
 		}
 	}
@@ -230,7 +565,12 @@ func (i *MetricItem) generateValue(start time.Time) (float64, error) {
 	return result, nil
 }
 
-// Build a *Collection from a file
+// Build a *Collection from a yaml, json or toml file. The format is detected
+// by the file extension or the content. The file can contain environment
+// variable references and, if marked as such, go template expressions (see
+// renderConfig).
+// Unknown fields are rejected. All problems are reported as ValidationErrors
+// carrying the position in the (rendered) file.
 func FromYamlFile(filename string) (*Collection, error) {
 
 	data, err := os.ReadFile(filename)
@@ -238,68 +578,196 @@ func FromYamlFile(filename string) (*Collection, error) {
 		return nil, fmt.Errorf(err.Error())
 	}
 
-	c := Collection{}
+	data, validationErrors, err := renderConfig(filename, data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
 
-	err = yaml.Unmarshal(data, &c)
+	root, err := parseConfig(detectFormat(filename, data), data)
 	if err != nil {
 		return nil, fmt.Errorf("cannot unmarshal %v: %v", filename, err)
 	}
 
-	var validationErrors []string
+	nodes := make(map[string]*yaml.Node)
+	indexNodes(root, "", nodes)
 
-	if c.Version == "" {
-		validationErrors = append(validationErrors, "missing version")
-	}
+	c := Collection{}
 
-	if len(c.Metrics) == 0 {
-		validationErrors = append(validationErrors, "metrics must have one or more elements")
+	validationErrors = append(validationErrors, unknownFields(root, reflect.TypeOf(c), "")...)
+	if len(root.Content) > 0 {
+		err = root.Decode(&c)
+		if typeError, ok := err.(*yaml.TypeError); ok {
+			validationErrors = append(validationErrors, typeErrors(typeError, nodes)...)
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal %v: %v", filename, err)
+		}
 	}
 
-	for i := range c.Metrics {
-		metric := c.Metrics[i]
-		metric.parent = &c
+	validationErrors = append(validationErrors, c.expandEnv()...)
+	validationErrors = c.check(validationErrors, filename, nodes)
+	if len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
 
-		if !isInSlice(metric.Type, validMetricTypes) {
-			validationErrors = append(validationErrors, fmt.Sprintf("metric %v: Unknown type %q. Must be one of gauge, counter, summary, histogram", metric.Name, metric.Type))
+	for i, metric := range c.Metrics {
+		if node, ok := nodes[fmt.Sprintf("metrics[%d]", i)]; ok {
+			metric.pos = Position{File: filename, Line: node.Line, Column: node.Column}
+		}
+	}
+	for i, scenario := range c.Scenarios {
+		for j, phase := range scenario.Phases {
+			for k, o := range phase.Overrides {
+				if node, ok := nodes[fmt.Sprintf("scenarios[%d].phases[%d].overrides[%d]", i, j, k)]; ok {
+					o.pos = Position{File: filename, Line: node.Line, Column: node.Column}
+				}
+			}
 		}
+	}
 
-		if len(metric.Items) == 0 {
-			validationErrors = append(validationErrors, fmt.Sprintf("metric %v: Must have at least one metricitem", metric.Name))
-		} else {
-			for j := range metric.Items {
-				item := metric.Items[j]
-				item.parent = metric
+	return &c, nil
+}
 
-				if item.Min > item.Max {
-					validationErrors = append(validationErrors, fmt.Sprintf("metric %v: min > max", c.Metrics[i].Name))
-				}
+// Build a single *Collection from several files and/or directories. A
+// directory contributes all *.yaml, *.yml, *.json and *.toml files directly
+// contained in it (in lexical order). The metrics of all files are merged into
+// one collection.
+func FromYamlPaths(paths []string) (*Collection, error) {
+	filenames, err := YamlFiles(paths)
+	if err != nil {
+		return nil, err
+	}
 
-				if !isInSlice(item.Func, validFunctions) {
-					validationErrors = append(validationErrors, fmt.Sprintf("metric %v: Unknown func %q. Must be one of rand, asc, desc, sin", c.Metrics[i].Name, item.Func))
-				}
-				if item.Interval == 0 {
-					validationErrors = append(validationErrors, fmt.Sprintf("metric %v: Invalid interval. Must be 1s or longer", c.Metrics[i].Name))
-				}
-				var keys []string
-				for _, key := range reflect.ValueOf(item.Labels).MapKeys() {
-					keys = append(keys, key.String())
-				}
-				sort.Strings(keys)
-				sort.Strings(metric.Labels)
-				if !stringSlicesEqual(keys, metric.Labels) {
-					validationErrors = append(validationErrors, fmt.Sprintf("metric %v: Label mismatch. Item=%v, metric=%v", c.Metrics[i].Name, keys, metric.Labels))
-				}
-			}
+	var result *Collection
+	var validationErrors ValidationErrors
+	for _, filename := range filenames {
+		c, err := FromYamlFile(filename)
+		if err != nil {
+			return nil, err
 		}
+		if result == nil {
+			result = c
+			continue
+		}
+		validationErrors = append(validationErrors, result.merge(c)...)
 	}
 
 	if len(validationErrors) > 0 {
-		errorMessage := ""
-		for i := 0; i < len(validationErrors); i++ {
-			errorMessage += fmt.Sprintf("%v. %v", i+1, validationErrors[i]) + "; "
+		return nil, validationErrors
+	}
+
+	return result, nil
+}
+
+// Expand paths to the list of files as read by FromYamlPaths
+func YamlFiles(paths []string) ([]string, error) {
+	var filenames []string
+	for _, path := range paths {
+		// Errors of non-existing paths are reported when reading the file
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			filenames = append(filenames, path)
+			continue
+		}
+		dirFiles, err := configFilesInDir(path)
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("input has %v validation errors: %v", len(validationErrors), errorMessage)
+		if len(dirFiles) == 0 {
+			return nil, fmt.Errorf("directory %v contains no config files", path)
+		}
+		filenames = append(filenames, dirFiles...)
 	}
 
-	return &c, nil
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no input files")
+	}
+	return filenames, nil
+}
+
+// List the config files directly contained in dir. Symlinks are followed
+// because that is how k8s mounts ConfigMap entries. Hidden entries (like the
+// "..data" dir of a ConfigMap mount) are ignored.
+func configFilesInDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if FormatOfFile(entry.Name()) == "" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		result = append(result, path)
+	}
+	return result, nil
+}
+
+// Move all metrics and scenarios of other into c. Metric and scenario names
+// must be unique across both collections, the returned list contains the
+// conflicts, which are not moved.
+func (c *Collection) merge(other *Collection) ValidationErrors {
+	var result ValidationErrors
+	if c.Namespace != other.Namespace || c.Subsystem != other.Subsystem || labelSetKey(c.ConstLabels) != labelSetKey(other.ConstLabels) {
+		err := newValidationError("", "namespace, subsystem and constLabels must be identical in all files")
+		if len(other.Metrics) > 0 {
+			err.File = other.Metrics[0].pos.File
+		}
+		result = append(result, err)
+	}
+	// Overrides may match items of the other files
+	for _, scenario := range c.Scenarios {
+		for _, phase := range scenario.Phases {
+			result = append(result, phase.validateRanges("", other.Metrics)...)
+		}
+	}
+	for _, scenario := range other.Scenarios {
+		for _, phase := range scenario.Phases {
+			result = append(result, phase.validateRanges("", c.Metrics)...)
+		}
+	}
+	for _, metric := range other.Metrics {
+		if existing, ok := c.GetMetric(metric.Name); ok {
+			var err *ValidationError
+			if !stringSlicesEqual(existing.Labels, metric.Labels) {
+				err = newValidationError("", "conflicting labels %v, already defined with labels %v at %v", metric.Labels, existing.Labels, existing.pos)
+			} else {
+				err = newValidationError("", "duplicate metric name, already defined at %v", existing.pos)
+			}
+			err.Position = metric.pos
+			err.Metric = metric.Name
+			result = append(result, err)
+			continue
+		}
+		metric.parent = c
+		c.Metrics = append(c.Metrics, metric)
+	}
+	for _, scenario := range other.Scenarios {
+		duplicate := false
+		for _, existing := range c.Scenarios {
+			if existing.Name == scenario.Name {
+				duplicate = true
+			}
+		}
+		if duplicate {
+			err := newValidationError("", "duplicate scenario name %q", scenario.Name)
+			if len(other.Metrics) > 0 {
+				err.File = other.Metrics[0].pos.File
+			}
+			result = append(result, err)
+			continue
+		}
+		c.Scenarios = append(c.Scenarios, scenario)
+	}
+	return result
 }
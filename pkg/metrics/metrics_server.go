@@ -2,74 +2,197 @@ package metrics
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Default time between refreshes of the metrics
+const DefaultRefresh = 15 * time.Second
+
 // Create and setup metrics and collection
 func SetupMetricsCollection(config *Collection) error {
+	return config.register(prometheus.DefaultRegisterer)
+}
+
+// Register the collection. The collection is registered as a whole, so that
+// metrics can be added, replaced and removed while it is being served.
+func (c *Collection) register(registerer prometheus.Registerer) error {
+	for _, metric := range c.Metrics {
+		if err := c.setupMetric(metric, registerer); err != nil {
+			return err
+		}
+	}
+	if err := registerer.Register(&collectionCollector{c}); err != nil {
+		return err
+	}
+	c.serving = &serving{registerer: registerer}
+	return nil
+}
+
+// Create the prometheus vector of a metric. The vector must not conflict
+// with the other metrics of the collection nor with the collectors of the
+// registerer, e.g. the go collector.
+func (c *Collection) setupMetric(metric *Metric, registerer prometheus.Registerer) error {
+	opts := prometheus.Opts{
+		Namespace:   c.Namespace,
+		Subsystem:   c.Subsystem,
+		Name:        metric.Name,
+		Help:        metric.Help,
+		ConstLabels: c.ConstLabels,
+	}
+
+	var collector prometheus.Collector
+
+	switch metric.Type {
+	case "gauge":
+		vec := prometheus.NewGaugeVec(prometheus.GaugeOpts(opts), metric.Labels)
+
+		metric.prometheus.gauge = vec
+		collector = vec
+	case "info":
+		if !strings.HasSuffix(opts.Name, "_info") {
+			opts.Name += "_info"
+		}
+		vec := prometheus.NewGaugeVec(prometheus.GaugeOpts(opts), metric.Labels)
+
+		metric.prometheus.gauge = vec
+		collector = vec
+	case "stateset":
+		// One series per state, the state is a label named like the metric.
+		// The metric may not be linked to c yet, see FullName.
+		labels := append(append([]string{}, metric.Labels...), prometheus.BuildFQName(c.Namespace, c.Subsystem, metric.Name))
+		vec := prometheus.NewGaugeVec(prometheus.GaugeOpts(opts), labels)
+
+		metric.prometheus.gauge = vec
+		collector = vec
+	case "counter":
+		vec := prometheus.NewCounterVec(prometheus.CounterOpts(opts), metric.Labels)
 
-	for i := range config.Metrics {
-		metric := config.Metrics[i]
-
-		switch metric.Type {
-		case "gauge":
-			vec := prometheus.NewGaugeVec(
-				prometheus.GaugeOpts{
-					Name: metric.Name,
-					Help: metric.Help,
-				},
-				metric.Labels,
-			)
-
-			metric.prometheus.gauge = vec
-			prometheus.MustRegister(vec)
-		case "counter":
-			vec := prometheus.NewCounterVec(
-				prometheus.CounterOpts{
-					Name: metric.Name,
-					Help: metric.Help,
-				},
-				metric.Labels,
-			)
-
-			metric.prometheus.counter = vec
-			prometheus.MustRegister(vec)
-		case "summary":
-			vec := prometheus.NewSummaryVec(
-				prometheus.SummaryOpts{
-					Name: metric.Name,
-					Help: metric.Help,
-				},
-				metric.Labels,
-			)
-
-			metric.prometheus.summary = vec
-			prometheus.MustRegister(vec)
-
-		case "histogram":
-			vec := prometheus.NewHistogramVec(
-				prometheus.HistogramOpts{
-					Name: metric.Name,
-					Help: metric.Help,
-				},
-				metric.Labels,
-			)
-
-			metric.prometheus.histogram = vec
-			prometheus.MustRegister(vec)
-		default:
-			return fmt.Errorf("metric %v: type %q not defined", i, metric.Type)
+		metric.prometheus.counter = vec
+		collector = vec
+	case "summary":
+		// The allowed error shrinks towards the tail, e.g. 0.5: 0.05, 0.99: 0.001
+		var objectives map[float64]float64
+		for _, q := range metric.Quantiles {
+			if objectives == nil {
+				objectives = make(map[float64]float64)
+			}
+			objectives[q] = (1 - q) / 10
 		}
+		vec := prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   opts.Subsystem,
+				Name:        opts.Name,
+				Help:        opts.Help,
+				ConstLabels: opts.ConstLabels,
+				Objectives:  objectives,
+			},
+			metric.Labels,
+		)
+
+		metric.prometheus.summary = vec
+		collector = vec
+	case "histogram", "gaugehistogram":
+		// The prometheus text format has no gauge histograms, they are
+		// exposed as histograms
+		vec := prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   opts.Subsystem,
+				Name:        opts.Name,
+				Help:        opts.Help,
+				ConstLabels: opts.ConstLabels,
+				Buckets:     metric.Buckets,
+			},
+			metric.Labels,
+		)
 
-		config.Metrics[i] = metric
+		metric.prometheus.histogram = vec
+		collector = vec
+	case "unknown", "untyped":
+		vec := newUntypedVec(opts, metric.Labels)
+
+		metric.prometheus.untyped = vec
+		collector = vec
+	default:
+		return fmt.Errorf("metric %v: type %q not defined", metric.Name, metric.Type)
+	}
 
+	// Check the vector like registering it would (e.g. for invalid names).
+	// The collection is an unchecked collector, so conflicts would only show
+	// upon every scrape.
+	registry := prometheus.NewRegistry()
+	for _, other := range c.Metrics {
+		if other.Name != metric.Name && other.prometheus.collector != nil {
+			registry.Register(describingCollector{other.prometheus.collector})
+		}
+	}
+	if err := registry.Register(collector); err != nil {
+		return fmt.Errorf("metric %v: %v", metric.Name, err)
+	}
+	if registerer != nil {
+		probe := nameProbe{prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), "", nil, nil)}
+		if err := registerer.Register(probe); err != nil {
+			return fmt.Errorf("metric %v: conflicts with a registered metric: %v", metric.Name, err)
+		}
+		registerer.Unregister(probe)
 	}
+	metric.prometheus.collector = collector
+
 	return nil
 }
 
+// Remove the prometheus vector of a metric, i.e. all of its series
+func (c *Collection) unregisterMetric(metric *Metric) {
+	metric.prometheus.collector = nil
+}
+
+// Describes the metrics of a collector without collecting any, to check them
+// against the collectors of a registry
+type describingCollector struct {
+	prometheus.Collector
+}
+
+func (d describingCollector) Collect(ch chan<- prometheus.Metric) {
+}
+
+// Describes a metric name to check it against the collectors of a registry.
+// Help and labels are left out as a registry remembers them even after
+// unregistering, i.e. checking the name again with other labels would
+// conflict.
+type nameProbe struct {
+	desc *prometheus.Desc
+}
+
+func (p nameProbe) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.desc
+}
+
+func (p nameProbe) Collect(ch chan<- prometheus.Metric) {
+}
+
+// Collects the current metrics of a collection. It describes no metrics, i.e.
+// it is an unchecked collector, because the metrics can change at any time.
+type collectionCollector struct {
+	c *Collection
+}
+
+func (cc *collectionCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+func (cc *collectionCollector) Collect(ch chan<- prometheus.Metric) {
+	defer cc.c.lock()()
+	for _, metric := range cc.c.Metrics {
+		if metric.prometheus.collector != nil {
+			metric.prometheus.collector.Collect(ch)
+		}
+	}
+}
+
 // Start async metrics refresh in intervals
 func StartMetricsCollection(c *Collection, refresh time.Duration) {
 	startTime := time.Now()
@@ -87,16 +210,75 @@ func StartMetricsCollection(c *Collection, refresh time.Duration) {
 	}()
 }
 
+// Remove the series of an item from the prometheus vector, i.e. the item is
+// absent from the exposition instead of reporting 0
+func (m *Metric) deleteSeries(labels map[string]string) {
+	switch m.Type {
+	case "gauge", "info":
+		m.prometheus.gauge.Delete(labels)
+	case "stateset":
+		for _, state := range m.States {
+			stateLabels := map[string]string{m.FullName(): state}
+			for name, value := range labels {
+				stateLabels[name] = value
+			}
+			m.prometheus.gauge.Delete(stateLabels)
+		}
+	case "summary":
+		m.prometheus.summary.Delete(labels)
+	case "histogram", "gaugehistogram":
+		m.prometheus.histogram.Delete(labels)
+	case "counter":
+		m.prometheus.counter.Delete(labels)
+	case "unknown", "untyped":
+		m.prometheus.untyped.Delete(labels)
+	}
+}
+
 func refreshMetricsCollection(c *Collection, startTime time.Time) error {
+	return refreshMetricsCollectionAt(c, time.Since(startTime))
+}
+
+// Refresh the metrics to their values at the given time since the start of
+// the simulation. Counters and histograms accumulate since the previous
+// refresh.
+func refreshMetricsCollectionAt(c *Collection, elapsed time.Duration) error {
+	defer c.lock()()
+
 	var wg sync.WaitGroup
 
 	callbackChannel := make(chan func() error)
 
+	overrides := c.activeOverrides(elapsed)
+
 	for i := range c.Metrics {
 		metric := c.Metrics[i]
 
 		for _, metricItem := range metric.Items {
-			newVal, _ := metricItem.generateValue(startTime)
+			if !metricItem.isActive(elapsed) {
+				metric.deleteSeries(metricItem.seriesLabels())
+				metricItem.active = false
+				continue
+			}
+
+			// A series which (re)appears starts with fresh state, also if
+			// the refreshes missed its absence
+			if since := metricItem.activePeriodStart(elapsed); !metricItem.active || since != metricItem.activeSince {
+				if metricItem.active {
+					metric.deleteSeries(metricItem.seriesLabels())
+				}
+				metricItem.resetState(since)
+				metricItem.active, metricItem.activeSince = true, since
+			}
+			if old := metricItem.rotate(elapsed); old != nil {
+				metric.deleteSeries(old)
+				churnedSeries.WithLabelValues(metric.FullName()).Inc()
+				metricItem.resetState(elapsed)
+			}
+			labels := metricItem.seriesLabels()
+
+			item := metricItem.withOverrides(metric, overrides)
+			newVal, _ := item.ValueAt(elapsed)
 			//TODO error handling not working. Should not abort refresh process
 			//if err != nil {
 			//	return err
@@ -104,13 +286,43 @@ func refreshMetricsCollection(c *Collection, startTime time.Time) error {
 
 			switch metric.Type {
 			case "gauge":
-				metric.prometheus.gauge.With(metricItem.Labels).Set(newVal)
+				metric.prometheus.gauge.With(labels).Set(newVal)
+			case "info":
+				metric.prometheus.gauge.With(labels).Set(1)
+			case "stateset":
+				active := metric.stateIndex(newVal)
+				for k, state := range metric.States {
+					stateLabels := map[string]string{metric.FullName(): state}
+					for name, value := range labels {
+						stateLabels[name] = value
+					}
+					if k == active {
+						metric.prometheus.gauge.With(stateLabels).Set(1)
+					} else {
+						metric.prometheus.gauge.With(stateLabels).Set(0)
+					}
+				}
 			case "summary":
-				metric.prometheus.summary.With(metricItem.Labels).Observe(newVal)
+				summary := metric.prometheus.summary.With(labels)
+				for n := metricItem.observationCount(elapsed); n > 0; n-- {
+					summary.Observe(item.observation(elapsed))
+				}
 			case "histogram":
-				metric.prometheus.histogram.With(metricItem.Labels).Observe(newVal)
+				histogram := metric.prometheus.histogram.With(labels)
+				for n := metricItem.observationCount(elapsed); n > 0; n-- {
+					histogram.Observe(item.observation(elapsed))
+				}
+			case "gaugehistogram":
+				// The distribution is replaced instead of accumulated
+				metric.prometheus.histogram.Delete(labels)
+				histogram := metric.prometheus.histogram.With(labels)
+				for n := metricItem.observationCount(elapsed); n > 0; n-- {
+					histogram.Observe(item.observation(elapsed))
+				}
 			case "counter":
-				metric.prometheus.counter.With(metricItem.Labels).Add(newVal)
+				metric.prometheus.counter.With(labels).Add(metricItem.increase(newVal, elapsed))
+			case "unknown", "untyped":
+				metric.prometheus.untyped.Set(labels, newVal)
 			}
 		}
 	}
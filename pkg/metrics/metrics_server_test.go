@@ -1,6 +1,14 @@
 package metrics
 
-import "testing"
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
 
 func Test_SetupMetricsCollection(t *testing.T) {
 	tests := []struct {
@@ -21,3 +29,322 @@ func Test_SetupMetricsCollection(t *testing.T) {
 		})
 	}
 }
+
+func Test_SetupMetricsCollection_constLabels(t *testing.T) {
+	os.Setenv("SIM_EXPORTER_TEST_REPLICA", "replica-1")
+	defer os.Unsetenv("SIM_EXPORTER_TEST_REPLICA")
+
+	c, err := FromYamlFile("testdata/const_labels.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupMetricsCollection(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := refreshMetricsCollection(c, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "sim_staging_requests_total" {
+			continue
+		}
+		got := make(map[string]string)
+		for _, label := range family.GetMetric()[0].GetLabel() {
+			got[label.GetName()] = label.GetValue()
+		}
+		want := map[string]string{"code": "200", "env": "staging", "simulator_replica": "replica-1"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("labels = %v, want %v", got, want)
+		}
+		return
+	}
+	t.Errorf("metric sim_staging_requests_total not found")
+}
+
+func Test_SetupMetricsCollection_openMetricsTypes(t *testing.T) {
+	c, err := FromYamlFile("testdata/openmetrics_types.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupMetricsCollection(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := refreshMetricsCollection(c, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int)
+	for _, family := range families {
+		got[family.GetName()] = len(family.GetMetric())
+	}
+	want := map[string]int{
+		"om_build_info":         1,
+		"om_door":               2,
+		"om_request_size_bytes": 1,
+		"om_legacy":             1,
+	}
+	for name, series := range want {
+		if got[name] != series {
+			t.Errorf("metric %v has %v series, want %v", name, got[name], series)
+		}
+	}
+}
+
+func Test_refreshMetricsCollection_lifecycle(t *testing.T) {
+	c, err := FromYamlFile("testdata/lifecycle.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupMetricsCollection(c); err != nil {
+		t.Fatal(err)
+	}
+
+	devices := func() []string {
+		families, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []string
+		for _, family := range families {
+			if family.GetName() != "lifecycle_disk_free_bytes" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				result = append(result, metric.GetLabel()[0].GetValue())
+			}
+		}
+		return result
+	}
+
+	// sdb starts after 1h
+	if err := refreshMetricsCollection(c, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got := devices(); !reflect.DeepEqual(got, []string{"sda"}) {
+		t.Errorf("devices = %v, want [sda]", got)
+	}
+
+	if err := refreshMetricsCollection(c, time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := devices(); !reflect.DeepEqual(got, []string{"sda", "sdb"}) {
+		t.Errorf("devices = %v, want [sda sdb]", got)
+	}
+
+	// The item disappears again
+	c.Metrics[0].Items[0].End = time.Hour
+	if err := refreshMetricsCollection(c, time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := devices(); !reflect.DeepEqual(got, []string{"sdb"}) {
+		t.Errorf("devices = %v, want [sdb]", got)
+	}
+}
+
+func Test_refreshMetricsCollection_churn(t *testing.T) {
+	c, err := FromYamlFile("testdata/churn.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupMetricsCollection(c); err != nil {
+		t.Fatal(err)
+	}
+
+	pods := func() []string {
+		families, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []string
+		for _, family := range families {
+			if family.GetName() != "churn_http_requests_total" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				result = append(result, metric.GetLabel()[0].GetValue())
+			}
+		}
+		return result
+	}
+
+	start := time.Now()
+	if err := refreshMetricsCollection(c, start); err != nil {
+		t.Fatal(err)
+	}
+	first := pods()
+	if len(first) != 1 {
+		t.Fatalf("pods = %v, want 1 series", first)
+	}
+
+	// One period later the series is replaced
+	if err := refreshMetricsCollection(c, start.Add(-10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	second := pods()
+	if len(second) != 1 || second[0] == first[0] {
+		t.Errorf("pods = %v, want 1 series other than %v", second, first)
+	}
+	if got := testutil.ToFloat64(churnedSeries.WithLabelValues("churn_http_requests_total")); got != 1 {
+		t.Errorf("churned series = %v, want 1", got)
+	}
+}
+
+func Test_refreshMetricsCollection_scenario(t *testing.T) {
+	c := NewCollection()
+	m := NewMetric("scenario_errors", "gauge", WithLabels("instance"))
+	for _, instance := range []string{"web-1", "web-3"} {
+		if err := m.AddItem(NewItem(1, 1, WithLabelValues(map[string]string{"instance": instance}))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.AddMetric(m); err != nil {
+		t.Fatal(err)
+	}
+	ten := 10.0
+	c.Scenarios = []*Scenario{{
+		Name: "incident",
+		Phases: []*Phase{
+			{Name: "normal", Duration: 30 * time.Minute},
+			{Name: "errors", Duration: 10 * time.Minute, Overrides: []*Override{{Selector: map[string]string{"instance": "web-3"}, Min: &ten, Max: &ten}}},
+		},
+	}}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	if err := c.register(registry); err != nil {
+		t.Fatal(err)
+	}
+
+	values := func() map[string]float64 {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := make(map[string]float64)
+		for _, metric := range families[0].GetMetric() {
+			result[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+		}
+		return result
+	}
+
+	start := time.Now()
+	for _, step := range []struct {
+		elapsed time.Duration
+		want    map[string]float64
+	}{
+		{elapsed: 0, want: map[string]float64{"web-1": 1, "web-3": 1}},
+		{elapsed: 35 * time.Minute, want: map[string]float64{"web-1": 1, "web-3": 10}},
+		{elapsed: 45 * time.Minute, want: map[string]float64{"web-1": 1, "web-3": 1}},
+	} {
+		if err := refreshMetricsCollection(c, start.Add(-step.elapsed)); err != nil {
+			t.Fatal(err)
+		}
+		if got := values(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("after %v: values = %v, want %v", step.elapsed, got, step.want)
+		}
+	}
+}
+
+func Test_SetupMetricsCollection_conflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics []*Metric
+		wantErr bool
+	}{
+		{name: "go collector", metrics: []*Metric{NewMetric("go_goroutines", "gauge")}, wantErr: true},
+		{name: "process collector", metrics: []*Metric{NewMetric("process_start_time_seconds", "gauge")}, wantErr: true},
+		{name: "churned series", metrics: []*Metric{NewMetric("sim_exporter_churned_series_total", "counter", WithLabels("metric"))}, wantErr: true},
+		{name: "within collection", metrics: []*Metric{NewMetric("conflict_info", "gauge"), NewMetric("conflict", "info")}, wantErr: true},
+		{name: "no conflict", metrics: []*Metric{NewMetric("no_conflict", "gauge")}, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCollection()
+			for _, m := range tt.metrics {
+				if err := c.AddMetric(m); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := SetupMetricsCollection(c); (err != nil) != tt.wantErr {
+				t.Errorf("SetupMetricsCollection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCollection_AddMetric_conflicts(t *testing.T) {
+	c, _ := servedCollection(t)
+	c.serving.registerer = prometheus.DefaultRegisterer
+
+	if err := c.AddMetric(NewMetric("go_goroutines", "gauge")); err == nil {
+		t.Errorf("AddMetric() of go_goroutines succeeded, want conflict with the go collector")
+	}
+	if err := c.AddMetric(NewMetric("a_info", "gauge")); err != nil {
+		t.Errorf("AddMetric() error = %v", err)
+	}
+	if err := c.ReplaceMetric(NewMetric("b", "gauge", WithLabels("other"))); err != nil {
+		t.Errorf("ReplaceMetric() error = %v", err)
+	}
+	if err := c.ReplaceMetric(NewMetric("a", "info")); err == nil {
+		t.Errorf("ReplaceMetric() of a as info succeeded, want conflict with a_info")
+	}
+	if _, ok := c.GetMetric("go_goroutines"); ok {
+		t.Errorf("conflicting metric added")
+	}
+}
+
+func TestCollection_AddMetric_itemLabels(t *testing.T) {
+	c, _ := servedCollection(t)
+
+	m := NewMetric("c", "gauge", WithLabels("a"))
+	m.Items = []*MetricItem{NewItem(1, 1, WithLabelValues(map[string]string{"b": "x"}))}
+	if err := c.AddMetric(m); err == nil {
+		t.Errorf("AddMetric() with items not matching the labels succeeded")
+	}
+	if _, ok := c.GetMetric("c"); ok {
+		t.Errorf("metric with invalid items added")
+	}
+	if err := refreshMetricsCollection(c, time.Now()); err != nil {
+		t.Errorf("refreshMetricsCollection() error = %v", err)
+	}
+}
+
+func TestCollection_AddMetric_statesetWithNamespace(t *testing.T) {
+	c := NewCollection(WithNamespace("sim"))
+	registry := prometheus.NewRegistry()
+	if err := c.register(registry); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMetric("door", "stateset", WithStates("open", "closed"))
+	if err := m.AddItem(NewItem(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddMetric(m); err != nil {
+		t.Fatalf("AddMetric() error = %v", err)
+	}
+	replacement := NewMetric("door", "stateset", WithStates("open", "closed"))
+	if err := replacement.AddItem(NewItem(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ReplaceMetric(replacement); err != nil {
+		t.Fatalf("ReplaceMetric() error = %v", err)
+	}
+	if err := refreshMetricsCollection(c, time.Now()); err != nil {
+		t.Fatalf("refreshMetricsCollection() error = %v", err)
+	}
+	want := map[string][]string{"sim_door": {"closed", "open"}}
+	if got := gatherSeries(t, registry); !reflect.DeepEqual(got, want) {
+		t.Errorf("series = %v, want %v", got, want)
+	}
+}
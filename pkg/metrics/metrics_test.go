@@ -5,8 +5,11 @@ import (
 	"math"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func generateTempConfig(content []string) (fileName string, err error) {
@@ -329,6 +332,28 @@ func Test_FromYamlFile(t *testing.T) {
 			//}),
 			wantErr: false,
 		},
+		{
+			name: "duplicate-metric",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: c",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 1",
+				"    func: rand",
+				"    interval: 10m",
+				"- name: c",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 1",
+				"    func: rand",
+				"    interval: 10m",
+			},
+			wantErr: true,
+		},
 		{
 			name: "valid-metric-nolabel-gauge",
 			content: []string{
@@ -429,6 +454,127 @@ func Test_FromYamlFile(t *testing.T) {
 	}
 }
 
+func Test_FromYamlPaths(t *testing.T) {
+	tests := []struct {
+		name      string
+		paths     []string
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name:    "no-paths",
+			paths:   []string{},
+			wantErr: true,
+		},
+		{
+			name:    "no-such-file",
+			paths:   []string{"no-such-file"},
+			wantErr: true,
+		},
+		{
+			name:      "single-file",
+			paths:     []string{"testdata/merge/a.yaml"},
+			wantNames: []string{"merge_a"},
+		},
+		{
+			name:      "two-files",
+			paths:     []string{"testdata/merge/b.yml", "testdata/merge/a.yaml"},
+			wantNames: []string{"merge_b", "merge_a"},
+		},
+		{
+			name:      "directory",
+			paths:     []string{"testdata/merge"},
+			wantNames: []string{"merge_a", "merge_b"},
+		},
+		{
+			name:    "directory-without-yaml",
+			paths:   []string{"../errors"},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate-metric",
+			paths:   []string{"testdata/merge", "testdata/merge_duplicate.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "conflicting-labels",
+			paths:   []string{"testdata/merge/a.yaml", "testdata/merge_conflict.yaml"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromYamlPaths(tt.paths)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FromYamlPaths() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			var gotNames []string
+			for _, m := range got.Metrics {
+				gotNames = append(gotNames, m.Name)
+				if m.ParentCollection() != got {
+					t.Errorf("FromYamlPaths() metric %v has wrong parent", m.Name)
+				}
+			}
+			if !reflect.DeepEqual(gotNames, tt.wantNames) {
+				t.Errorf("FromYamlPaths() names = %v, want %v", gotNames, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestCollection_merge(t *testing.T) {
+	tests := []struct {
+		name    string
+		other   Collection
+		wantErr bool
+	}{
+		{
+			name:    "same-settings",
+			other:   Collection{Namespace: "sim", ConstLabels: map[string]string{"env": "test"}, Metrics: []*Metric{{Name: "b"}}},
+			wantErr: false,
+		},
+		{
+			name:    "other-namespace",
+			other:   Collection{Namespace: "other", ConstLabels: map[string]string{"env": "test"}, Metrics: []*Metric{{Name: "b"}}},
+			wantErr: true,
+		},
+		{
+			name:    "other-const-labels",
+			other:   Collection{Namespace: "sim", ConstLabels: map[string]string{"env": "prod"}, Metrics: []*Metric{{Name: "b"}}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate-metric",
+			other:   Collection{Namespace: "sim", ConstLabels: map[string]string{"env": "test"}, Metrics: []*Metric{{Name: "a"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collection{Namespace: "sim", ConstLabels: map[string]string{"env": "test"}, Metrics: []*Metric{{Name: "a"}}}
+			if got := c.merge(&tt.other); (len(got) > 0) != tt.wantErr {
+				t.Errorf("merge() = %v, wantErr %v", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCollection_merge_duplicateScenario(t *testing.T) {
+	existing := &Scenario{Name: "s"}
+	c := &Collection{Metrics: []*Metric{{Name: "a"}}, Scenarios: []*Scenario{existing}}
+	other := &Collection{Metrics: []*Metric{{Name: "b"}}, Scenarios: []*Scenario{{Name: "s"}, {Name: "t"}}}
+	if got := c.merge(other); len(got) != 1 {
+		t.Errorf("merge() = %v, want 1 error", got)
+	}
+	if len(c.Scenarios) != 2 || c.Scenarios[0] != existing || c.Scenarios[1].Name != "t" {
+		t.Errorf("merge() scenarios = %v, want the existing s and t", c.Scenarios)
+	}
+}
+
 /*
 func TestCollection_initialize(t *testing.T) {
 	type fields struct {
@@ -908,3 +1054,216 @@ func TestMetricItem_generateValue(t *testing.T) {
 		})
 	}
 }
+
+func TestMetricItem_isActive(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    MetricItem
+		elapsed time.Duration
+		want    bool
+	}{
+		{name: "no lifecycle", item: MetricItem{}, elapsed: time.Hour, want: true},
+		{name: "before start", item: MetricItem{Start: time.Minute}, elapsed: 30 * time.Second, want: false},
+		{name: "at start", item: MetricItem{Start: time.Minute}, elapsed: time.Minute, want: true},
+		{name: "before end", item: MetricItem{End: time.Minute}, elapsed: 59 * time.Second, want: true},
+		{name: "at end", item: MetricItem{End: time.Minute}, elapsed: time.Minute, want: false},
+		{name: "within ttl", item: MetricItem{Start: time.Minute, TTL: time.Minute}, elapsed: 90 * time.Second, want: true},
+		{name: "after ttl", item: MetricItem{Start: time.Minute, TTL: time.Minute}, elapsed: 2 * time.Minute, want: false},
+		{name: "present in period", item: MetricItem{Absence: &Absence{Every: 10 * time.Minute, For: time.Minute}}, elapsed: 18 * time.Minute, want: true},
+		{name: "absent in period", item: MetricItem{Absence: &Absence{Every: 10 * time.Minute, For: time.Minute}}, elapsed: 19 * time.Minute, want: false},
+		{name: "absence counted from start", item: MetricItem{Start: 5 * time.Minute, Absence: &Absence{Every: 10 * time.Minute, For: time.Minute}}, elapsed: 19 * time.Minute, want: true},
+		{name: "present after absence", item: MetricItem{Absence: &Absence{Every: 10 * time.Minute, For: time.Minute}}, elapsed: 20 * time.Minute, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.item.isActive(tt.elapsed); got != tt.want {
+				t.Errorf("isActive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricItem_activePeriodStart(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    MetricItem
+		elapsed time.Duration
+		want    time.Duration
+	}{
+		{name: "no lifecycle", item: MetricItem{}, elapsed: time.Hour, want: 0},
+		{name: "start", item: MetricItem{Start: time.Minute}, elapsed: time.Hour, want: time.Minute},
+		{name: "first period", item: MetricItem{Absence: &Absence{Every: 10 * time.Minute, For: time.Minute}}, elapsed: 8 * time.Minute, want: 0},
+		{name: "after absence", item: MetricItem{Absence: &Absence{Every: 10 * time.Minute, For: time.Minute}}, elapsed: 22 * time.Minute, want: 20 * time.Minute},
+		{name: "absence counted from start", item: MetricItem{Start: 5 * time.Minute, Absence: &Absence{Every: 10 * time.Minute, For: time.Minute}}, elapsed: 19 * time.Minute, want: 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.item.activePeriodStart(tt.elapsed); got != tt.want {
+				t.Errorf("activePeriodStart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Build a served collection with a private registry
+func servedCollection(t *testing.T) (*Collection, *prometheus.Registry) {
+	c := NewCollection()
+	for _, name := range []string{"a", "b"} {
+		m := NewMetric(name, "gauge", WithLabels("l"))
+		for _, value := range []string{"x", "y"} {
+			if err := m.AddItem(NewItem(1, 1, WithLabelValues(map[string]string{"l": value}))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := c.AddMetric(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry := prometheus.NewRegistry()
+	if err := c.register(registry); err != nil {
+		t.Fatal(err)
+	}
+	if err := refreshMetricsCollection(c, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return c, registry
+}
+
+// Series per metric family of a registry, e.g. {"a": ["x", "y"]}
+func gatherSeries(t *testing.T, registry *prometheus.Registry) map[string][]string {
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string][]string)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			var values []string
+			for _, label := range metric.GetLabel() {
+				values = append(values, label.GetValue())
+			}
+			result[family.GetName()] = append(result[family.GetName()], strings.Join(values, ","))
+		}
+	}
+	return result
+}
+
+func TestCollection_DeleteMetric(t *testing.T) {
+	c, registry := servedCollection(t)
+	a, _ := c.GetMetric("a")
+
+	if !c.DeleteMetric("a") {
+		t.Errorf("DeleteMetric() = false, want true")
+	}
+	if c.DeleteMetric("a") {
+		t.Errorf("DeleteMetric() = true, want false for a deleted metric")
+	}
+	if _, ok := c.GetMetric("a"); ok || len(c.Metrics) != 1 || a.ParentCollection() != nil {
+		t.Errorf("metric a not removed")
+	}
+	want := map[string][]string{"b": {"x", "y"}}
+	if got := gatherSeries(t, registry); !reflect.DeepEqual(got, want) {
+		t.Errorf("series = %v, want %v", got, want)
+	}
+
+	// The name can be used again
+	m := NewMetric("a", "counter")
+	if err := m.AddItem(NewItem(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddMetric(m); err != nil {
+		t.Errorf("AddMetric() error = %v", err)
+	}
+}
+
+func TestCollection_ReplaceMetric(t *testing.T) {
+	c, registry := servedCollection(t)
+
+	m := NewMetric("a", "gauge", WithLabels("other"))
+	if err := m.AddItem(NewItem(2, 2, WithLabelValues(map[string]string{"other": "z"}))); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ReplaceMetric(m); err != nil {
+		t.Fatalf("ReplaceMetric() error = %v", err)
+	}
+	if got, _ := c.GetMetric("a"); got != m || m.ParentCollection() != c || m.Items[0].ParentMetric() != m {
+		t.Errorf("metric not replaced or parents not set")
+	}
+	if err := refreshMetricsCollection(c, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"a": {"z"}, "b": {"x", "y"}}
+	if got := gatherSeries(t, registry); !reflect.DeepEqual(got, want) {
+		t.Errorf("series = %v, want %v", got, want)
+	}
+
+	if err := c.ReplaceMetric(NewMetric("c", "gauge")); err == nil {
+		t.Errorf("ReplaceMetric() error = nil, want error for unknown metric")
+	}
+	inconsistent := NewMetric("b", "gauge", WithLabels("l"))
+	inconsistent.Items = []*MetricItem{NewItem(1, 1)}
+	if err := c.ReplaceMetric(inconsistent); err == nil {
+		t.Errorf("ReplaceMetric() error = nil, want label mismatch")
+	}
+}
+
+func TestMetric_DeleteItem(t *testing.T) {
+	c, registry := servedCollection(t)
+	a, _ := c.GetMetric("a")
+
+	if !a.DeleteItem(map[string]string{"l": "x"}) {
+		t.Errorf("DeleteItem() = false, want true")
+	}
+	if a.DeleteItem(map[string]string{"l": "x"}) {
+		t.Errorf("DeleteItem() = true, want false for a deleted item")
+	}
+	if err := refreshMetricsCollection(c, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"a": {"y"}, "b": {"x", "y"}}
+	if got := gatherSeries(t, registry); !reflect.DeepEqual(got, want) {
+		t.Errorf("series = %v, want %v", got, want)
+	}
+}
+
+func TestMetric_ReplaceItem(t *testing.T) {
+	c, _ := servedCollection(t)
+	a, _ := c.GetMetric("a")
+
+	item := NewItem(5, 5, WithLabelValues(map[string]string{"l": "x"}))
+	if err := a.ReplaceItem(item); err != nil {
+		t.Fatalf("ReplaceItem() error = %v", err)
+	}
+	if got, _ := a.GetItem(map[string]string{"l": "x"}); got != item || item.ParentMetric() != a {
+		t.Errorf("item not replaced or parent not set")
+	}
+	if err := a.ReplaceItem(NewItem(5, 5, WithLabelValues(map[string]string{"l": "z"}))); err == nil {
+		t.Errorf("ReplaceItem() error = nil, want error for unknown item")
+	}
+	if err := a.ReplaceItem(NewItem(5, 5, WithLabelValues(map[string]string{"m": "x"}))); err == nil {
+		t.Errorf("ReplaceItem() error = nil, want label mismatch")
+	}
+}
+
+func TestMetric_UpdateItem(t *testing.T) {
+	c, _ := servedCollection(t)
+	a, _ := c.GetMetric("a")
+	labels := map[string]string{"l": "x"}
+	original, _ := a.GetItem(labels)
+
+	if err := a.UpdateItem(labels, func(i *MetricItem) { i.Max = 10 }); err != nil {
+		t.Fatalf("UpdateItem() error = %v", err)
+	}
+	if got, _ := a.GetItem(labels); got != original || got.Max != 10 || got.ParentMetric() != a {
+		t.Errorf("item = %+v, want max 10 in place", got)
+	}
+	if err := a.UpdateItem(labels, func(i *MetricItem) { i.Labels["l"] = "z" }); err == nil {
+		t.Errorf("UpdateItem() error = nil, want error for changed labels")
+	}
+	if original.Labels["l"] != "x" {
+		t.Errorf("labels changed by failed update: %v", original.Labels)
+	}
+	if err := a.UpdateItem(map[string]string{"l": "z"}, func(i *MetricItem) {}); err == nil {
+		t.Errorf("UpdateItem() error = nil, want error for unknown item")
+	}
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"strings"
+)
+
+// Formats of a scrape
+const (
+	ScrapeFormatPrometheus  = "prometheus"
+	ScrapeFormatOpenMetrics = "openmetrics"
+)
+
+var (
+	// Valid formats of a scrape, empty means detected
+	validScrapeFormats = []string{"", ScrapeFormatPrometheus, ScrapeFormatOpenMetrics}
+
+	// Accept headers by scrape format, like prometheus sends them
+	scrapeAcceptHeaders = map[string]string{
+		"":                      "application/openmetrics-text;version=1.0.0;q=0.5,text/plain;version=0.0.4;q=0.3,*/*;q=0.1",
+		ScrapeFormatPrometheus:  "text/plain;version=0.0.4;q=1,*/*;q=0.1",
+		ScrapeFormatOpenMetrics: "application/openmetrics-text;version=1.0.0;q=1,*/*;q=0.1",
+	}
+)
+
+// Whether format is a valid scrape format
+func IsValidScrapeFormat(format string) bool {
+	return isInSlice(format, validScrapeFormats)
+}
+
+// The format of a scrape. OpenMetrics must end with "# EOF".
+func detectScrapeFormat(lines *[]string) string {
+	for k := len(*lines) - 1; k >= 0; k-- {
+		line := strings.TrimSpace((*lines)[k])
+		if line == "" {
+			continue
+		}
+		if line == "# EOF" {
+			return ScrapeFormatOpenMetrics
+		}
+		break
+	}
+	return ScrapeFormatPrometheus
+}
+
+// Index of the first unquoted occurrence of sep in line, -1 if none
+func indexUnquoted(line string, sep string) int {
+	quoted, escaped := false, false
+	for k := 0; k < len(line); k++ {
+		switch {
+		case escaped:
+			escaped = false
+		case line[k] == '\\':
+			escaped = true
+		case line[k] == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(line[k:], sep):
+			return k
+		}
+	}
+	return -1
+}
+
+// A sample of OpenMetrics as text format sample: without exemplar and
+// without timestamp (OpenMetrics timestamps are seconds, not milliseconds)
+func openMetricsSample(line string) string {
+	if k := indexUnquoted(line, " # "); k >= 0 {
+		line = line[:k]
+	}
+	name := line
+	if k := indexUnquoted(line, "}"); k >= 0 {
+		name, line = line[:k+1], line[k+1:]
+	} else if k := strings.IndexAny(line, " \t"); k >= 0 {
+		name, line = line[:k], line[k:]
+	} else {
+		return name
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return name
+	}
+	return name + " " + fields[0]
+}
+
+// Turn OpenMetrics into the prometheus text format. Counters are renamed to
+// the name of their "_total" samples, likewise their "_created" samples.
+// Gauge histograms get the sample names of histograms. Exemplars, timestamps
+// and "# EOF" are dropped. Lines are replaced, never added or removed, so
+// that line numbers remain correct.
+func openMetricsToText(lines *[]string) *[]string {
+	types := make(map[string]string)
+	for _, line := range *lines {
+		if matches := regexpScrapeComment.FindStringSubmatch(line); matches != nil && matches[1] == "TYPE" {
+			types[matches[2]] = strings.TrimSpace(matches[3])
+		}
+	}
+
+	result := make([]string, 0, len(*lines))
+	for _, line := range *lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "# EOF":
+			line = ""
+		case strings.HasPrefix(trimmed, "#"):
+			matches := regexpScrapeComment.FindStringSubmatch(line)
+			if matches != nil && types[matches[2]] == "counter" && !strings.HasSuffix(matches[2], "_total") {
+				line = "# " + matches[1] + " " + matches[2] + "_total" + matches[3]
+			}
+		case trimmed != "":
+			line = openMetricsSample(line)
+			matches := regexpSampleName.FindStringSubmatch(line)
+			if matches == nil {
+				break
+			}
+			name := matches[1]
+			if base := strings.TrimSuffix(name, "_created"); base != name && types[base] == "counter" {
+				line = strings.Replace(line, name, base+"_total_created", 1)
+			}
+			for suffix, replacement := range map[string]string{"_gcount": "_count", "_gsum": "_sum"} {
+				if base := strings.TrimSuffix(name, suffix); base != name && types[base] == "gaugehistogram" {
+					line = strings.Replace(line, name, base+replacement, 1)
+				}
+			}
+		}
+		result = append(result, line)
+	}
+	return &result
+}
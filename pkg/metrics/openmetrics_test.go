@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_detectScrapeFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{name: "empty", lines: []string{}, want: ScrapeFormatPrometheus},
+		{name: "text", lines: []string{`# TYPE a gauge`, `a 1`}, want: ScrapeFormatPrometheus},
+		{name: "openmetrics", lines: []string{`# TYPE a gauge`, `a 1`, `# EOF`}, want: ScrapeFormatOpenMetrics},
+		{name: "trailing-newline", lines: []string{`a 1`, `# EOF`, ``}, want: ScrapeFormatOpenMetrics},
+		{name: "eof-not-last", lines: []string{`# EOF`, `a 1`}, want: ScrapeFormatPrometheus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectScrapeFormat(&tt.lines); got != tt.want {
+				t.Errorf("detectScrapeFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_openMetricsSample(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: `a 1`, want: `a 1`},
+		{line: `a 1 1520879607.789`, want: `a 1`},
+		{line: `a{l="x"} 1 # {trace_id="abc"} 1 1520879607.789`, want: `a{l="x"} 1`},
+		{line: `a{l="x # y"} 1 # {trace_id="abc"} 1`, want: `a{l="x # y"} 1`},
+		{line: `a{l="say \"}\""} 2 123`, want: `a{l="say \"}\""} 2`},
+		{line: `a`, want: `a`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := openMetricsSample(tt.line); got != tt.want {
+				t.Errorf("openMetricsSample() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseScrape_openMetricsNotes(t *testing.T) {
+	lines, err := readLines("testdata/openmetrics_scrape.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, notes, err := parseScrape(lines, "")
+	if err != nil {
+		t.Fatalf("parseScrape() error = %v", err)
+	}
+	if len(notes) > 0 {
+		t.Errorf("parseScrape() notes = %q, want none", notes)
+	}
+}
+
+func Test_convertScrapeToConfig_openMetrics(t *testing.T) {
+	lines, err := readLines("testdata/openmetrics_scrape.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"", ScrapeFormatOpenMetrics} {
+		t.Run(format, func(t *testing.T) {
+			c, err := convertScrapeToConfig(lines, format, ConvertFilter{}, nil, 10, "rand", "15s-15s", "percent")
+			if err != nil {
+				t.Fatalf("convertScrapeToConfig() error = %v", err)
+			}
+
+			var names, types []string
+			for _, m := range c.Metrics {
+				names = append(names, m.Name)
+				types = append(types, m.Type)
+			}
+			wantNames := []string{"http_requests_total", "request_duration_seconds", "build", "door", "temperature", "latency_seconds"}
+			wantTypes := []string{"counter", "gauge", "info", "stateset", "unknown", "histogram"}
+			if !reflect.DeepEqual(names, wantNames) || !reflect.DeepEqual(types, wantTypes) {
+				t.Errorf("metrics = %v %v, want %v %v", names, types, wantNames, wantTypes)
+			}
+
+			requests, _ := c.GetMetric("http_requests_total")
+			if requests.Help != "Requests served" || len(requests.Items) != 2 {
+				t.Errorf("http_requests_total = %+v, want help and 2 items", requests)
+			}
+			duration, _ := c.GetMetric("request_duration_seconds")
+			if duration.Unit != "seconds" || duration.Items[0].Labels["path"] != "/a # b" {
+				t.Errorf("request_duration_seconds = %+v, want unit seconds and path label", duration)
+			}
+			latency, _ := c.GetMetric("latency_seconds")
+			if latency.Unit != "seconds" || !reflect.DeepEqual(latency.Buckets, []float64{0.1}) || latency.Items[0].Rate <= 0 {
+				t.Errorf("latency_seconds = %+v, want unit, buckets and rate (from _created)", latency)
+			}
+			door, _ := c.GetMetric("door")
+			if !reflect.DeepEqual(door.States, []string{"open", "closed"}) {
+				t.Errorf("door states = %v, want [open closed]", door.States)
+			}
+			if err := c.Validate(); err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+
+	// Read as text format, the sample with an OpenMetrics timestamp and
+	// exemplar is skipped
+	_, notes, err := parseScrape(lines, ScrapeFormatPrometheus)
+	if err != nil {
+		t.Fatalf("parseScrape() as text format error = %v", err)
+	}
+	if len(notes) == 0 || !strings.HasPrefix(notes[0], "skipped line 3: ") {
+		t.Errorf("parseScrape() as text format notes = %q, want line 3 skipped", notes)
+	}
+}
+
+func Test_openMetricsToText_counters(t *testing.T) {
+	lines := []string{
+		`# TYPE a counter`,
+		`a_total 1`,
+		`a_created 123`,
+		`a_total{l="x"} 2`,
+		`a_created{l="x"} 123`,
+		`# EOF`,
+	}
+	got := openMetricsToText(&lines)
+	want := []string{`# TYPE a_total counter`, `a_total 1`, `a_total_created 123`, `a_total{l="x"} 2`, `a_total_created{l="x"} 123`, ``}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("openMetricsToText() = %q, want %q", *got, want)
+	}
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"text/template"
+)
+
+// Reference to an environment variable, i.e. ${VAR} or ${VAR:-default}.
+// A leading "$" escapes the reference, i.e. $${VAR} renders as ${VAR}.
+var regexpEnvReference = regexp.MustCompile(`\$(\$?)\{([a-zA-Z_][a-zA-Z0-9_]*)(:-([^}]*))?\}`)
+
+// Reference to an environment variable without braces, i.e. $VAR. Only
+// resolved in the values of const labels.
+var regexpBareEnvReference = regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)`)
+
+// First line of a configuration which is a go template. Other files are not
+// executed as template, e.g. as their help texts may contain "{{".
+const templateMarker = "# sim-exporter: template"
+
+// Functions available in configuration templates
+var templateFuncs = template.FuncMap{
+	// Value of an environment variable, empty if unset
+	"env": os.Getenv,
+	// Value, or the default if value is empty. Use as pipeline, e.g. {{ env "X" | default "1" }}
+	"default": func(def string, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+}
+
+// Resolve the configuration data read from filename. If the data starts with
+// the template marker, it is first executed as go template (the marker
+// becomes an empty line, so that json can be templated as well). Then
+// references to environment variables are replaced. Referencing an unset
+// variable without default is a validation error, its position refers to the
+// rendered data.
+func renderConfig(filename string, data []byte) ([]byte, ValidationErrors, error) {
+	if isTemplate(data) {
+		tmpl, err := template.New(filename).Funcs(templateFuncs).Parse(string(data[len(templateMarker):]))
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot parse template: %v", err)
+		}
+		var rendered bytes.Buffer
+		if err := tmpl.Execute(&rendered, nil); err != nil {
+			return nil, nil, fmt.Errorf("cannot render template: %v", err)
+		}
+		data = rendered.Bytes()
+	}
+
+	result, validationErrors := substituteEnv(data)
+	for _, e := range validationErrors {
+		e.File = filename
+	}
+	return result, validationErrors, nil
+}
+
+// Whether the configuration data is a go template
+func isTemplate(data []byte) bool {
+	firstLine := data
+	if k := bytes.IndexByte(data, '\n'); k >= 0 {
+		firstLine = data[:k]
+	}
+	return string(bytes.TrimRight(firstLine, " \t\r")) == templateMarker
+}
+
+// Replace references to environment variables in const label values, also
+// those without braces ($VAR). Referencing an unset variable is an error.
+func (c *Collection) expandEnv() ValidationErrors {
+	var result ValidationErrors
+	for name, value := range c.ConstLabels {
+		c.ConstLabels[name] = regexpBareEnvReference.ReplaceAllStringFunc(value, func(reference string) string {
+			env, ok := os.LookupEnv(reference[1:])
+			if !ok {
+				result = append(result, newValidationError("constLabels."+name, "environment variable %q is not set", reference[1:]))
+			}
+			return env
+		})
+	}
+	return result
+}
+
+// Replace references to environment variables by their values
+func substituteEnv(data []byte) ([]byte, ValidationErrors) {
+	var validationErrors ValidationErrors
+	var result bytes.Buffer
+
+	last := 0
+	for _, match := range regexpEnvReference.FindAllSubmatchIndex(data, -1) {
+		result.Write(data[last:match[0]])
+		last = match[1]
+
+		if match[3] > match[2] {
+			// escaped, drop the escaping "$"
+			result.Write(data[match[0]+1 : match[1]])
+			continue
+		}
+
+		name := string(data[match[4]:match[5]])
+		value, ok := os.LookupEnv(name)
+		hasDefault := match[6] >= 0
+		if hasDefault && value == "" {
+			value = string(data[match[8]:match[9]])
+		} else if !ok {
+			line := bytes.Count(data[:match[0]], []byte("\n")) + 1
+			column := match[0] - (bytes.LastIndexByte(data[:match[0]], '\n') + 1) + 1
+			validationError := newValidationError("", "environment variable %q is not set", name)
+			validationError.Line = line
+			validationError.Column = column
+			validationErrors = append(validationErrors, validationError)
+		}
+		result.WriteString(value)
+	}
+	result.Write(data[last:])
+
+	return result.Bytes(), validationErrors
+}
+
+// Read a configuration file and resolve templates and environment variables
+// as done when loading it. Unset environment variables are rendered empty.
+func RenderYamlFile(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	result, _, err := renderConfig(filename, data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_substituteEnv(t *testing.T) {
+	os.Setenv("SIM_EXPORTER_TEST_SET", "value")
+	os.Setenv("SIM_EXPORTER_TEST_EMPTY", "")
+	defer os.Unsetenv("SIM_EXPORTER_TEST_SET")
+	defer os.Unsetenv("SIM_EXPORTER_TEST_EMPTY")
+
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr string
+	}{
+		{name: "no-reference", data: "a: $1 and $b", want: "a: $1 and $b"},
+		{name: "set", data: "a: ${SIM_EXPORTER_TEST_SET}", want: "a: value"},
+		{name: "empty", data: "a: ${SIM_EXPORTER_TEST_EMPTY}", want: "a: "},
+		{name: "default-unset", data: "a: ${SIM_EXPORTER_TEST_UNSET:-1m}", want: "a: 1m"},
+		{name: "default-empty", data: "a: ${SIM_EXPORTER_TEST_EMPTY:-1m}", want: "a: 1m"},
+		{name: "default-set", data: "a: ${SIM_EXPORTER_TEST_SET:-1m}", want: "a: value"},
+		{name: "empty-default", data: "a: ${SIM_EXPORTER_TEST_UNSET:-}", want: "a: "},
+		{name: "escaped", data: "a: $${SIM_EXPORTER_TEST_SET}", want: "a: ${SIM_EXPORTER_TEST_SET}"},
+		{name: "unset", data: "a: 1\nb: x${SIM_EXPORTER_TEST_UNSET}", want: "a: 1\nb: x", wantErr: `2:5: environment variable "SIM_EXPORTER_TEST_UNSET" is not set`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, validationErrors := substituteEnv([]byte(tt.data))
+			if string(got) != tt.want {
+				t.Errorf("substituteEnv() = %q, want %q", got, tt.want)
+			}
+			gotErr := ""
+			if len(validationErrors) > 0 {
+				gotErr = validationErrors[0].Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Errorf("substituteEnv() error = %q, want %q", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_renderConfig(t *testing.T) {
+	os.Setenv("SIM_EXPORTER_TEST_SET", "value")
+	defer os.Unsetenv("SIM_EXPORTER_TEST_SET")
+
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", data: "a: 1", want: "a: 1"},
+		{name: "env", data: "# sim-exporter: template\n" + `a: {{ env "SIM_EXPORTER_TEST_SET" }}`, want: "\na: value"},
+		{name: "default", data: "# sim-exporter: template\n" + `a: {{ env "SIM_EXPORTER_TEST_UNSET" | default "2" }}`, want: "\na: 2"},
+		{name: "condition", data: "# sim-exporter: template\n" + `a: {{ if env "SIM_EXPORTER_TEST_UNSET" }}1{{ else }}2{{ end }}`, want: "\na: 2"},
+		{name: "unknown-func", data: "# sim-exporter: template\n" + `a: {{ foo }}`, wantErr: true},
+		{name: "template-then-env", data: "# sim-exporter: template\n" + `a: {{ "${SIM_EXPORTER_TEST_SET}" }}`, want: "\na: value"},
+		{name: "syntax-error", data: "# sim-exporter: template\na: {{ ", wantErr: true},
+		{name: "json", data: "# sim-exporter: template\r\n" + `{"a": {{ 1 }}}`, want: "\r\n" + `{"a": 1}`},
+		{name: "not-a-template", data: "help: Use {{ .Value }} here\nb: ${SIM_EXPORTER_TEST_SET}", want: "help: Use {{ .Value }} here\nb: value"},
+		{name: "marker-not-first", data: "a: 1\n# sim-exporter: template\nb: {{ 2 }}", want: "a: 1\n# sim-exporter: template\nb: {{ 2 }}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := renderConfig("config.yaml", []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Errorf("renderConfig() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollection_expandEnv(t *testing.T) {
+	os.Setenv("SIM_EXPORTER_TEST_SET", "value")
+	defer os.Unsetenv("SIM_EXPORTER_TEST_SET")
+
+	c := NewCollection(WithConstLabels(map[string]string{"a": "$SIM_EXPORTER_TEST_SET", "b": "x-$SIM_EXPORTER_TEST_SET-y", "c": "plain"}))
+	if errs := c.expandEnv(); len(errs) > 0 {
+		t.Errorf("expandEnv() errors = %v", errs)
+	}
+	want := map[string]string{"a": "value", "b": "x-value-y", "c": "plain"}
+	if !reflect.DeepEqual(c.ConstLabels, want) {
+		t.Errorf("ConstLabels = %v, want %v", c.ConstLabels, want)
+	}
+
+	c = NewCollection(WithConstLabels(map[string]string{"a": "$SIM_EXPORTER_TEST_UNSET"}))
+	if errs := c.expandEnv(); len(errs) != 1 || errs[0].Error() != `environment variable "SIM_EXPORTER_TEST_UNSET" is not set` {
+		t.Errorf("expandEnv() errors = %v, want unset variable", errs)
+	}
+}
@@ -0,0 +1,267 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Per-metric settings of convert. The first rule which matches an item
+// applies, the command line flags apply to whatever it leaves unset and to
+// items without matching rule.
+type ConvertRules struct {
+	Rules []*ConvertRule `yaml:"rules"`
+}
+
+type ConvertRule struct {
+	// Regular expression of the metric names (which must match the whole
+	// name). All metrics if unset
+	Metric string `yaml:"metric,omitempty"`
+
+	// Label matchers which the items must all satisfy, e.g. code=~"5.."
+	Match []string `yaml:"match,omitempty"`
+
+	// Maximum deviation in percent of the value (0-100)
+	Deviation *int `yaml:"deviation,omitempty"`
+
+	// Deviation as absolute amount, e.g. for percentages. Exclusive with
+	// deviation
+	AbsoluteDeviation *float64 `yaml:"absoluteDeviation,omitempty"`
+
+	// Limits of min and max, e.g. 0-100 for percentages
+	Clamp *Clamp `yaml:"clamp,omitempty"`
+
+	// Functions and interval like the command line flags, e.g. "sin,asc"
+	// and "10m-2h"
+	Function string `yaml:"function,omitempty"`
+	Interval string `yaml:"interval,omitempty"`
+
+	// How counters are simulated: "rate" (the default) or "increment" (per
+	// refresh of DefaultRefresh)
+	Mode string `yaml:"mode,omitempty"`
+
+	metric   *regexp.Regexp
+	matchers []*labelMatcher
+}
+
+// Lower and/or upper limit of values
+type Clamp struct {
+	Min *float64 `yaml:"min,omitempty"`
+	Max *float64 `yaml:"max,omitempty"`
+}
+
+// The settings by which an item is converted
+type convertSettings struct {
+	deviation float64
+	absolute  bool
+	clamp     Clamp
+	function  string
+	interval  string
+	mode      string
+}
+
+// Read conversion rules from a yaml, json or toml file. Like for
+// configurations, unknown fields are rejected and all problems are reported
+// as ValidationErrors carrying the position in the file.
+func ReadConvertRules(filename string) (*ConvertRules, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := parseConfig(detectFormat(filename, data), data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal %v: %v", filename, err)
+	}
+	nodes := make(map[string]*yaml.Node)
+	indexNodes(root, "", nodes)
+
+	r := &ConvertRules{}
+	validationErrors := unknownFields(root, reflect.TypeOf(*r), "")
+	if len(root.Content) > 0 {
+		err = root.Decode(r)
+		if typeError, ok := err.(*yaml.TypeError); ok {
+			validationErrors = append(validationErrors, typeErrors(typeError, nodes)...)
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal %v: %v", filename, err)
+		}
+	}
+	if len(validationErrors) == 0 {
+		validationErrors = r.compile()
+	}
+
+	validationErrors.locate(filename, nodes)
+	validationErrors.sort()
+	if len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+	return r, nil
+}
+
+// Check the rules, e.g. ones built in code. This is the same validation which
+// ReadConvertRules applies. The result is nil or ValidationErrors (without
+// positions).
+func (r *ConvertRules) Validate() error {
+	if r == nil {
+		return nil
+	}
+	if validationErrors := r.compile(); len(validationErrors) > 0 {
+		return validationErrors
+	}
+	return nil
+}
+
+// Check the rules and compile their regular expressions
+func (r *ConvertRules) compile() ValidationErrors {
+	var result ValidationErrors
+	for k, rule := range r.Rules {
+		rulePath := fmt.Sprintf("rules[%d]", k)
+
+		rule.metric = nil
+		if rule.Metric != "" {
+			re, err := regexp.Compile("^(?:" + rule.Metric + ")$")
+			if err != nil {
+				result = append(result, newValidationError(rulePath+".metric", "invalid metric name regex %q: %v", rule.Metric, err))
+			}
+			rule.metric = re
+		}
+
+		rule.matchers = nil
+		for j, expr := range rule.Match {
+			matcher, err := parseLabelMatcher(expr)
+			if err != nil {
+				result = append(result, newValidationError(fmt.Sprintf("%v.match[%d]", rulePath, j), "%v", err))
+				continue
+			}
+			rule.matchers = append(rule.matchers, matcher)
+		}
+
+		if rule.Deviation != nil && (*rule.Deviation < 0 || *rule.Deviation > 100) {
+			result = append(result, newValidationError(rulePath+".deviation", "invalid deviation %v. Must be in range 0-100", *rule.Deviation))
+		}
+		if rule.AbsoluteDeviation != nil && *rule.AbsoluteDeviation < 0 {
+			result = append(result, newValidationError(rulePath+".absoluteDeviation", "invalid absoluteDeviation %v. Must not be negative", *rule.AbsoluteDeviation))
+		}
+		if rule.Deviation != nil && rule.AbsoluteDeviation != nil {
+			result = append(result, newValidationError(rulePath, "only one of deviation and absoluteDeviation can be set"))
+		}
+		if rule.Clamp != nil && rule.Clamp.Min != nil && rule.Clamp.Max != nil && *rule.Clamp.Min > *rule.Clamp.Max {
+			result = append(result, newValidationError(rulePath+".clamp.min", "clamp min (%v) > max (%v)", *rule.Clamp.Min, *rule.Clamp.Max))
+		}
+		if rule.Function != "" {
+			if _, err := randomFunc(rule.Function); err != nil {
+				result = append(result, newValidationError(rulePath+".function", "%v", err))
+			}
+		}
+		if rule.Interval != "" {
+			if _, err := randomDuration(rule.Interval); err != nil {
+				result = append(result, newValidationError(rulePath+".interval", "%v", err))
+			}
+		}
+		if rule.Mode != "" && !isInSlice(rule.Mode, validCounterModes) {
+			result = append(result, newValidationError(rulePath+".mode", "unknown mode %q. Must be one of %v", rule.Mode, strings.Join(validCounterModes, ", ")))
+		}
+	}
+	return result
+}
+
+// A copy of the rules without deviation, e.g. to observe exact values
+func (r *ConvertRules) withoutDeviation() *ConvertRules {
+	if r == nil {
+		return nil
+	}
+	result := &ConvertRules{}
+	for _, rule := range r.Rules {
+		copied := *rule
+		if copied.Deviation != nil || copied.AbsoluteDeviation != nil {
+			zero := 0
+			copied.Deviation, copied.AbsoluteDeviation = &zero, nil
+		}
+		result.Rules = append(result.Rules, &copied)
+	}
+	return result
+}
+
+// The first rule which matches the item, nil if none (or no rules)
+func (r *ConvertRules) match(metricName string, labels map[string]string) *ConvertRule {
+	if r == nil {
+		return nil
+	}
+	for _, rule := range r.Rules {
+		if rule.metric != nil && !rule.metric.MatchString(metricName) {
+			continue
+		}
+		matches := true
+		for _, matcher := range rule.matchers {
+			if !matcher.matches(labels) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return rule
+		}
+	}
+	return nil
+}
+
+// The settings of an item: those of the first matching rule, fallback for
+// anything the rule leaves unset
+func (r *ConvertRules) settings(metricName string, labels map[string]string, fallback convertSettings) convertSettings {
+	result := fallback
+	rule := r.match(metricName, labels)
+	if rule == nil {
+		return result
+	}
+	if rule.Deviation != nil {
+		result.deviation, result.absolute = float64(*rule.Deviation), false
+		result.clamp = Clamp{}
+	}
+	if rule.AbsoluteDeviation != nil {
+		result.deviation, result.absolute = *rule.AbsoluteDeviation, true
+		result.clamp = Clamp{}
+	}
+	if rule.Clamp != nil {
+		result.clamp = *rule.Clamp
+	}
+	if rule.Function != "" {
+		result.function = rule.Function
+	}
+	if rule.Interval != "" {
+		result.interval = rule.Interval
+	}
+	if rule.Mode != "" {
+		result.mode = rule.Mode
+	}
+	return result
+}
+
+// Min and max around value with the deviation of the settings, clamped
+func (s convertSettings) deviate(value float64) (min float64, max float64) {
+	if s.absolute {
+		min, max = value-s.deviation, value+s.deviation
+	} else {
+		min, max = randomRange(value, int(s.deviation))
+		// Negative values deviate the other way round
+		if min > max {
+			min, max = max, min
+		}
+	}
+	return s.clamp.apply(min), s.clamp.apply(max)
+}
+
+// The value limited to the clamp
+func (c Clamp) apply(value float64) float64 {
+	if c.Min != nil {
+		value = math.Max(*c.Min, value)
+	}
+	if c.Max != nil {
+		value = math.Min(*c.Max, value)
+	}
+	return value
+}
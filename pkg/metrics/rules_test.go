@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConvertRules(t *testing.T) {
+	r, err := ReadConvertRules("testdata/rules/convert_rules.yaml")
+	if err != nil {
+		t.Fatalf("ReadConvertRules() error = %v", err)
+	}
+	if len(r.Rules) != 4 || r.Rules[0].AbsoluteDeviation == nil || *r.Rules[0].AbsoluteDeviation != 5 {
+		t.Errorf("ReadConvertRules() = %+v, want 4 rules", r.Rules)
+	}
+
+	tests := []struct {
+		name    string
+		content []string
+		want    []string
+	}{
+		{
+			name: "errors",
+			content: []string{
+				"rules:",
+				"- metric: '('",
+				"  match: ['code']",
+				"  deviation: 200",
+				"- absoluteDeviation: -1",
+				"  clamp: {min: 10, max: 1}",
+				"  function: cos",
+				"  interval: 1s-1m",
+				"  mode: sometimes",
+				"- deviation: 5",
+				"  absoluteDeviation: 5",
+			},
+			want: []string{
+				"2:11: invalid metric name regex",
+				"3:11: invalid label matcher \"code\"",
+				"4:14: invalid deviation 200. Must be in range 0-100",
+				"5:22: invalid absoluteDeviation -1. Must not be negative",
+				"6:16: clamp min (10) > max (1)",
+				"7:13: unknown function \"cos\"",
+				"8:13: minimum duration \"1s\" too small",
+				"9:9: unknown mode \"sometimes\". Must be one of increment, rate",
+				"10:3: only one of deviation and absoluteDeviation can be set",
+			},
+		},
+		{
+			name:    "unknown-field",
+			content: []string{"rules:", "- metrik: a"},
+			want:    []string{"2:3: unknown field \"metrik\""},
+		},
+		{
+			name:    "type-error",
+			content: []string{"rules:", "- deviation: abc"},
+			want:    []string{"2:14: cannot unmarshal !!str `abc` into int"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "rules.yaml")
+			if err := os.WriteFile(filename, []byte(strings.Join(tt.content, "\n")), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadConvertRules(filename)
+			errs, ok := err.(ValidationErrors)
+			if !ok || len(errs) != len(tt.want) {
+				t.Fatalf("ReadConvertRules() error = %v, want %d validation errors", err, len(tt.want))
+			}
+			for k, want := range tt.want {
+				if got := errs[k].Error(); !strings.Contains(got, want) {
+					t.Errorf("error %d = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+
+	if _, err := ReadConvertRules("testdata/no-such-file.yaml"); err == nil {
+		t.Errorf("ReadConvertRules() of missing file succeeded, want error")
+	}
+}
+
+func Test_convertScrapeToConfig_rules(t *testing.T) {
+	r, err := ReadConvertRules("testdata/rules/convert_rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrapeLines := &[]string{
+		`# HELP cpu_usage_percent CPU usage`,
+		`# TYPE cpu_usage_percent gauge`,
+		`cpu_usage_percent 98`,
+		`# HELP temperature_celsius Temperature`,
+		`# TYPE temperature_celsius gauge`,
+		`temperature_celsius{room="kitchen"} 20`,
+		`temperature_celsius{room="cellar"} 10`,
+		`# HELP requests_total Requests`,
+		`# TYPE requests_total counter`,
+		`requests_total 7200`,
+		`# HELP queue_length Queue length`,
+		`# TYPE queue_length gauge`,
+		`queue_length 50`,
+	}
+	c, err := convertScrapeToConfig(scrapeLines, "", ConvertFilter{}, r, 100, "asc", "10m-10m", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	item := func(metricName string, labels map[string]string) *MetricItem {
+		m, ok := c.GetMetric(metricName)
+		if !ok {
+			t.Fatalf("metric %q missing", metricName)
+		}
+		item, ok := m.GetItem(labels)
+		if !ok {
+			t.Fatalf("item %v of %q missing", labels, metricName)
+		}
+		return item
+	}
+
+	cpu := item("cpu_usage_percent", nil)
+	if cpu.Min != 93 || cpu.Max != 100 || cpu.Func != "sin" || cpu.Interval.Minutes() != 1 {
+		t.Errorf("cpu = %v-%v %v %v, want 93-100 sin 1m", cpu.Min, cpu.Max, cpu.Func, cpu.Interval)
+	}
+	kitchen := item("temperature_celsius", map[string]string{"room": "kitchen"})
+	if kitchen.Min != 20 || kitchen.Max != 20 || kitchen.Func != "asc" {
+		t.Errorf("kitchen = %v-%v %v, want 20-20 asc (fallback func)", kitchen.Min, kitchen.Max, kitchen.Func)
+	}
+	// The cellar matches no rule and deviates by the fallback of 100%
+	cellar := item("temperature_celsius", map[string]string{"room": "cellar"})
+	if cellar.Min < 0 || cellar.Max > 20 || cellar.Interval.Minutes() != 10 {
+		t.Errorf("cellar = %v-%v %v, want within 0-20 and 10m", cellar.Min, cellar.Max, cellar.Interval)
+	}
+	// 7200 requests in the assumed hour are 2 per second, 30 per refresh
+	requests := item("requests_total", nil)
+	if requests.Mode != "increment" || requests.Initial != 7200 || requests.Min < 0 || requests.Max > 60 {
+		t.Errorf("requests = %v-%v mode %q initial %v, want within 0-60 per refresh", requests.Min, requests.Max, requests.Mode, requests.Initial)
+	}
+	queue := item("queue_length", nil)
+	if queue.Min < 45 || queue.Max > 100 {
+		t.Errorf("queue = %v-%v, want within 45-100", queue.Min, queue.Max)
+	}
+}
+
+func TestConvertRules_Validate(t *testing.T) {
+	var rules *ConvertRules
+	if err := rules.Validate(); err != nil {
+		t.Errorf("Validate() of nil rules = %v, want nil", err)
+	}
+	deviation := 101
+	rules = &ConvertRules{Rules: []*ConvertRule{{Metric: "a"}, {Deviation: &deviation}}}
+	err := rules.Validate()
+	if errs, ok := err.(ValidationErrors); !ok || len(errs) != 1 {
+		t.Errorf("Validate() = %v, want one error", err)
+	}
+	if rule := rules.match("b", nil); rule != rules.Rules[1] {
+		t.Errorf("match() = %+v, want the rule without metric", rule)
+	}
+}
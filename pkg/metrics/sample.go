@@ -0,0 +1,216 @@
+package metrics
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// How to reduce the items of a collection
+type SampleOptions struct {
+	// Items to keep per metric at most. Zero keeps all items
+	MaxItems int
+
+	// Label by whose values the items are chosen, so that the same values
+	// (like the same VMs) are kept in all metrics. Items of metrics without
+	// the label are chosen by their label set.
+	Label string
+
+	// Choose label values spread over the distribution of the item values
+	// instead of at random, so that low, medium and high values are all kept
+	Spread bool
+}
+
+// Reduce the items of every metric to at most MaxItems. The choice is
+// deterministic: label values are ranked once for the whole collection and
+// every metric keeps the items of the values ranked first, as many as fit.
+// Returns the number of removed items.
+func (c *Collection) Sample(o SampleOptions) int {
+	if o.MaxItems <= 0 {
+		return 0
+	}
+
+	var order []string
+	if o.Label != "" {
+		order = c.labelValueOrder(o.Label, o.Spread)
+	}
+	rank := make(map[string]int, len(order))
+	for k, value := range order {
+		rank[value] = k
+	}
+
+	var removed int
+	for _, m := range c.Metrics {
+		if len(m.Items) <= o.MaxItems {
+			continue
+		}
+		var kept []*MetricItem
+		if _, ok := m.Items[0].Labels[o.Label]; ok && o.Label != "" {
+			kept = sampleByLabel(m.Items, o.Label, rank, o.MaxItems)
+		} else {
+			kept = sampleByHash(m.Items, o.MaxItems)
+		}
+		removed += len(m.Items) - len(kept)
+		m.Items = kept
+	}
+	return removed
+}
+
+// Keep the items of the label values of the lowest rank. Values are kept
+// with all their items as long as they fit, only if the first value has
+// more items than max they are cut.
+func sampleByLabel(items []*MetricItem, label string, rank map[string]int, max int) []*MetricItem {
+	groups := make(map[string][]*MetricItem)
+	var values []string
+	for _, item := range items {
+		value := item.Labels[label]
+		if _, ok := groups[value]; !ok {
+			values = append(values, value)
+		}
+		groups[value] = append(groups[value], item)
+	}
+	sort.SliceStable(values, func(a, b int) bool { return rank[values[a]] < rank[values[b]] })
+
+	var result []*MetricItem
+	for _, value := range values {
+		if len(result)+len(groups[value]) > max {
+			break
+		}
+		result = append(result, groups[value]...)
+	}
+	if len(result) == 0 {
+		result = groups[values[0]][:max]
+	}
+	return keepOrder(items, result)
+}
+
+// Keep the items whose label sets hash lowest
+func sampleByHash(items []*MetricItem, max int) []*MetricItem {
+	sorted := append([]*MetricItem{}, items...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return hashOf(labelSetKey(sorted[a].Labels)) < hashOf(labelSetKey(sorted[b].Labels))
+	})
+	return keepOrder(items, sorted[:max])
+}
+
+// The kept items in their original order
+func keepOrder(items []*MetricItem, kept []*MetricItem) []*MetricItem {
+	keep := make(map[*MetricItem]bool, len(kept))
+	for _, item := range kept {
+		keep[item] = true
+	}
+	var result []*MetricItem
+	for _, item := range items {
+		if keep[item] {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// All values of the label in the collection, in the order in which they are
+// kept. At random (by hash) or spread: ordered by their typical rank among
+// the items of the metrics, then interleaved so that every prefix covers the
+// whole range.
+func (c *Collection) labelValueOrder(label string, spread bool) []string {
+	seen := make(map[string]bool)
+	var values []string
+	for _, m := range c.Metrics {
+		for _, item := range m.Items {
+			if value, ok := item.Labels[label]; ok && !seen[value] {
+				seen[value] = true
+				values = append(values, value)
+			}
+		}
+	}
+	sort.SliceStable(values, func(a, b int) bool { return hashOf(values[a]) < hashOf(values[b]) })
+	if !spread {
+		return values
+	}
+
+	score := c.labelValueScores(label)
+	sort.SliceStable(values, func(a, b int) bool { return score[values[a]] < score[values[b]] })
+	return interleave(values)
+}
+
+// The average normalized rank (0-1) of the label values by the mean value of
+// their items, over all metrics in which the label has several values. 0.5
+// if unknown.
+func (c *Collection) labelValueScores(label string) map[string]float64 {
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, m := range c.Metrics {
+		means := make(map[string]float64)
+		n := make(map[string]int)
+		for _, item := range m.Items {
+			value, ok := item.Labels[label]
+			mean := (item.Min + item.Max) / 2
+			if !ok || math.IsNaN(mean) || math.IsInf(mean, 0) {
+				continue
+			}
+			means[value] += mean
+			n[value]++
+		}
+		if len(means) < 2 {
+			continue
+		}
+		var values []string
+		for value := range means {
+			means[value] /= float64(n[value])
+			values = append(values, value)
+		}
+		sort.Slice(values, func(a, b int) bool {
+			if means[values[a]] != means[values[b]] {
+				return means[values[a]] < means[values[b]]
+			}
+			return hashOf(values[a]) < hashOf(values[b])
+		})
+		for k, value := range values {
+			sums[value] += float64(k) / float64(len(values)-1)
+			counts[value]++
+		}
+	}
+
+	result := make(map[string]float64)
+	for _, m := range c.Metrics {
+		for _, item := range m.Items {
+			if value, ok := item.Labels[label]; ok {
+				result[value] = 0.5
+				if counts[value] > 0 {
+					result[value] = sums[value] / float64(counts[value])
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Reorder sorted values so that every prefix is spread evenly over them:
+// first and last, then the middle, then the middles of both halves and so
+// on, e.g. 0, 7, 3, 1, 5, 2, 4, 6
+func interleave(sorted []string) []string {
+	n := len(sorted)
+	if n <= 2 {
+		return append([]string{}, sorted...)
+	}
+	type interval struct{ lo, hi int }
+	result := []string{sorted[0], sorted[n-1]}
+	queue := []interval{{0, n - 1}}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if next.hi-next.lo < 2 {
+			continue
+		}
+		mid := (next.lo + next.hi) / 2
+		result = append(result, sorted[mid])
+		queue = append(queue, interval{next.lo, mid}, interval{mid, next.hi})
+	}
+	return result
+}
+
+func hashOf(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
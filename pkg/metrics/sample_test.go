@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func Test_interleave(t *testing.T) {
+	tests := []struct {
+		name   string
+		sorted []string
+		want   []string
+	}{
+		{name: "empty", sorted: []string{}, want: []string{}},
+		{name: "one", sorted: []string{"a"}, want: []string{"a"}},
+		{name: "eight", sorted: []string{"0", "1", "2", "3", "4", "5", "6", "7"}, want: []string{"0", "7", "3", "1", "5", "2", "4", "6"}},
+		{name: "five", sorted: []string{"0", "1", "2", "3", "4"}, want: []string{"0", "4", "2", "1", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := interleave(tt.sorted); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("interleave() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A collection of 10 VMs with the cpu of every VM, 2 disks of every VM and
+// an unrelated metric. The values grow with the number of the VM.
+func sampleTestCollection(t *testing.T) *Collection {
+	c := NewCollection()
+	cpu := NewMetric("vm_cpu", "gauge", WithLabels("vm"))
+	disk := NewMetric("vm_disk_bytes", "gauge", WithLabels("vm", "disk"))
+	other := NewMetric("other", "gauge", WithLabels("x"))
+	for k := 0; k < 10; k++ {
+		vm := fmt.Sprintf("vm%d", k)
+		v := float64(k)
+		if err := cpu.AddItem(NewItem(v, v, WithLabelValues(map[string]string{"vm": vm}))); err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range []string{"sda", "sdb"} {
+			if err := disk.AddItem(NewItem(v, v, WithLabelValues(map[string]string{"vm": vm, "disk": d}))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := other.AddItem(NewItem(v, v, WithLabelValues(map[string]string{"x": vm}))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range []*Metric{cpu, disk, other} {
+		if err := c.AddMetric(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func vmsOf(m *Metric) []string {
+	var result []string
+	for _, item := range m.Items {
+		if len(result) == 0 || result[len(result)-1] != item.Labels["vm"] {
+			result = append(result, item.Labels["vm"])
+		}
+	}
+	return result
+}
+
+func TestCollection_Sample(t *testing.T) {
+	c := sampleTestCollection(t)
+	if removed := c.Sample(SampleOptions{}); removed != 0 {
+		t.Errorf("Sample() without max = %v, want 0", removed)
+	}
+
+	removed := c.Sample(SampleOptions{MaxItems: 4, Label: "vm"})
+	if removed != 6+16+6 {
+		t.Errorf("Sample() = %v, want %v", removed, 6+16+6)
+	}
+	cpu, disk, other := c.Metrics[0], c.Metrics[1], c.Metrics[2]
+	if len(cpu.Items) != 4 || len(disk.Items) != 4 || len(other.Items) != 4 {
+		t.Fatalf("items = %v %v %v, want 4 each", len(cpu.Items), len(disk.Items), len(other.Items))
+	}
+	// The VMs of the disks (2 items each) are those ranked first for cpu
+	vms := make(map[string]bool)
+	for _, vm := range vmsOf(cpu) {
+		vms[vm] = true
+	}
+	for _, vm := range vmsOf(disk) {
+		if !vms[vm] {
+			t.Errorf("disks of %v kept, which is not among the VMs %v of cpu", vm, vmsOf(cpu))
+		}
+	}
+
+	// The choice is deterministic
+	again := sampleTestCollection(t)
+	again.Sample(SampleOptions{MaxItems: 4, Label: "vm"})
+	if !reflect.DeepEqual(vmsOf(again.Metrics[0]), vmsOf(cpu)) {
+		t.Errorf("second sample kept %v, want %v", vmsOf(again.Metrics[0]), vmsOf(cpu))
+	}
+}
+
+func TestCollection_Sample_spread(t *testing.T) {
+	c := sampleTestCollection(t)
+	c.Sample(SampleOptions{MaxItems: 4, Label: "vm", Spread: true})
+
+	// The lowest and highest VMs come first, then the middle
+	if got, want := vmsOf(c.Metrics[1]), []string{"vm0", "vm9"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("disks of %v kept, want %v", got, want)
+	}
+	if got := vmsOf(c.Metrics[0]); len(got) != 4 || got[0] != "vm0" || got[3] != "vm9" {
+		t.Errorf("cpu of %v kept, want vm0, vm9 and two between", got)
+	}
+}
+
+func TestCollection_Sample_firstValueTooLarge(t *testing.T) {
+	c := sampleTestCollection(t)
+	c.Sample(SampleOptions{MaxItems: 1, Label: "vm"})
+	if len(c.Metrics[1].Items) != 1 {
+		t.Errorf("disk items = %v, want 1", len(c.Metrics[1].Items))
+	}
+}
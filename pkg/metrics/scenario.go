@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"time"
+)
+
+// A timeline of phases which temporarily change the parameters of items,
+// e.g. to script an incident
+type Scenario struct {
+	Name string `yaml:"name"`
+
+	// Start over after the last phase. Otherwise the items keep their own
+	// parameters after the last phase.
+	Loop bool `yaml:"loop,omitempty"`
+
+	Phases []*Phase `yaml:"phases"`
+
+	// index of the active phase, -1 if none
+	current int
+	// whether current was determined before
+	started bool
+}
+
+// A period of a scenario with its overrides
+type Phase struct {
+	Name      string        `yaml:"name"`
+	Duration  time.Duration `yaml:"duration"`
+	Overrides []*Override   `yaml:"overrides,omitempty"`
+}
+
+// Parameters which replace those of all matching items. Items match if they
+// belong to the metric (any metric if empty) and have all labels of the
+// selector. Unset parameters are not changed.
+type Override struct {
+	Metric   string            `yaml:"metric,omitempty"`
+	Selector map[string]string `yaml:"selector,omitempty"`
+	Min      *float64          `yaml:"min,omitempty"`
+	Max      *float64          `yaml:"max,omitempty"`
+	Func     string            `yaml:"func,omitempty"`
+	Interval time.Duration     `yaml:"interval,omitempty"`
+
+	// where the override was read from (if at all)
+	pos Position
+}
+
+// Index of the phase at the given time since the start of the simulation, -1
+// if the (non-looping) scenario is over
+func (s *Scenario) phaseAt(elapsed time.Duration) int {
+	var total time.Duration
+	for _, phase := range s.Phases {
+		total += phase.Duration
+	}
+	if total <= 0 {
+		return -1
+	}
+	if elapsed >= total {
+		if !s.Loop {
+			return -1
+		}
+		elapsed %= total
+	}
+	for k, phase := range s.Phases {
+		if elapsed < phase.Duration {
+			return k
+		}
+		elapsed -= phase.Duration
+	}
+	return -1
+}
+
+// Overrides of the active phases of all scenarios (in order). Phase changes
+// are logged.
+func (c *Collection) activeOverrides(elapsed time.Duration) []*Override {
+	var result []*Override
+	for _, scenario := range c.Scenarios {
+		current := scenario.phaseAt(elapsed)
+		if !scenario.started || current != scenario.current {
+			if current >= 0 {
+				log.Infof("scenario %q: phase %q started", scenario.Name, scenario.Phases[current].Name)
+			} else if scenario.started {
+				log.Infof("scenario %q: finished", scenario.Name)
+			}
+			scenario.current = current
+			scenario.started = true
+		}
+		if current >= 0 {
+			result = append(result, scenario.Phases[current].Overrides...)
+		}
+	}
+	return result
+}
+
+// Whether the override applies to an item of metric
+func (o *Override) matches(metric *Metric, item *MetricItem) bool {
+	if o.Metric != "" && o.Metric != metric.Name {
+		return false
+	}
+	for name, value := range o.Selector {
+		if itemValue, ok := item.Labels[name]; !ok || itemValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// The item of metric with the matching overrides applied. Returns the item
+// itself if no override matches.
+func (i *MetricItem) withOverrides(metric *Metric, overrides []*Override) *MetricItem {
+	result := i
+	for _, o := range overrides {
+		if !o.matches(metric, i) {
+			continue
+		}
+		if result == i {
+			copied := *i
+			result = &copied
+		}
+		if o.Min != nil {
+			result.Min = *o.Min
+		}
+		if o.Max != nil {
+			result.Max = *o.Max
+		}
+		if o.Func != "" {
+			result.Func = o.Func
+		}
+		if o.Interval != 0 {
+			result.Interval = o.Interval
+		}
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScenario_phaseAt(t *testing.T) {
+	phases := []*Phase{
+		{Name: "normal", Duration: 30 * time.Minute},
+		{Name: "errors", Duration: 10 * time.Minute},
+		{Name: "recovery", Duration: 20 * time.Minute},
+	}
+	tests := []struct {
+		name    string
+		loop    bool
+		elapsed time.Duration
+		want    int
+	}{
+		{name: "start", elapsed: 0, want: 0},
+		{name: "first phase", elapsed: 29 * time.Minute, want: 0},
+		{name: "second phase", elapsed: 30 * time.Minute, want: 1},
+		{name: "last phase", elapsed: 59 * time.Minute, want: 2},
+		{name: "over", elapsed: time.Hour, want: -1},
+		{name: "loop", loop: true, elapsed: time.Hour + 35*time.Minute, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scenario{Name: "s", Loop: tt.loop, Phases: phases}
+			if got := s.phaseAt(tt.elapsed); got != tt.want {
+				t.Errorf("phaseAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollection_activeOverrides(t *testing.T) {
+	first := &Override{Func: "asc"}
+	second := &Override{Func: "desc"}
+	c := &Collection{
+		Scenarios: []*Scenario{
+			{Name: "a", Phases: []*Phase{{Name: "a1", Duration: time.Minute, Overrides: []*Override{first}}, {Name: "a2", Duration: time.Minute}}},
+			{Name: "b", Loop: true, Phases: []*Phase{{Name: "b1", Duration: time.Hour, Overrides: []*Override{second}}}},
+		},
+	}
+	if got := c.activeOverrides(0); !reflect.DeepEqual(got, []*Override{first, second}) {
+		t.Errorf("activeOverrides() = %v, want both overrides", got)
+	}
+	if got := c.activeOverrides(90 * time.Second); !reflect.DeepEqual(got, []*Override{second}) {
+		t.Errorf("activeOverrides() = %v, want second override", got)
+	}
+	if c.Scenarios[0].current != 1 {
+		t.Errorf("current = %v, want 1", c.Scenarios[0].current)
+	}
+}
+
+func TestMetricItem_withOverrides(t *testing.T) {
+	metric := NewMetric("http_requests_total", "counter", WithLabels("code", "instance"))
+	item := NewItem(1, 2, WithLabelValues(map[string]string{"code": "500", "instance": "web-3"}))
+	if err := metric.AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+	min, max := 10.0, 20.0
+
+	tests := []struct {
+		name      string
+		overrides []*Override
+		want      MetricItem
+		same      bool
+	}{
+		{name: "none", same: true},
+		{name: "other metric", overrides: []*Override{{Metric: "other", Min: &min}}, same: true},
+		{name: "other labels", overrides: []*Override{{Selector: map[string]string{"instance": "web-1"}, Min: &min}}, same: true},
+		{name: "missing label", overrides: []*Override{{Selector: map[string]string{"pod": "web-3"}, Min: &min}}, same: true},
+		{
+			name:      "min and max",
+			overrides: []*Override{{Metric: "http_requests_total", Selector: map[string]string{"instance": "web-3"}, Min: &min, Max: &max}},
+			want:      MetricItem{Min: 10, Max: 20, Func: DefaultFunc, Interval: DefaultInterval},
+		},
+		{
+			name:      "later overrides win",
+			overrides: []*Override{{Max: &max, Func: "asc"}, {Func: "sin", Interval: time.Hour}},
+			want:      MetricItem{Min: 1, Max: 20, Func: "sin", Interval: time.Hour},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := item.withOverrides(metric, tt.overrides)
+			if tt.same {
+				if got != item {
+					t.Errorf("withOverrides() = %+v, want the item itself", got)
+				}
+				return
+			}
+			if got == item {
+				t.Fatalf("withOverrides() modified the item itself")
+			}
+			if got.Min != tt.want.Min || got.Max != tt.want.Max || got.Func != tt.want.Func || got.Interval != tt.want.Interval {
+				t.Errorf("withOverrides() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if item.Min != 1 || item.Max != 2 {
+		t.Errorf("item modified: %+v", item)
+	}
+}
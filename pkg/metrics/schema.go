@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+var (
+	// How a go duration must look like, e.g. "1h30m" or "90s"
+	regexpDuration = `^(0|([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+$`
+
+	// Properties which must be present, keyed by go type name
+	schemaRequired = map[string][]string{
+		"Collection": {"version", "metrics"},
+		"Metric":     {"name", "type", "items"},
+		"MetricItem": {"min", "max", "func", "interval"},
+		"Absence":    {"every", "for"},
+		"Churn":      {"label"},
+		"Scenario":   {"name", "phases"},
+		"Phase":      {"name", "duration"},
+		"Quantile":   {"quantile", "value"},
+	}
+
+	// Allowed property values, keyed by "<go type name>.<property>"
+	schemaEnums = map[string][]string{
+		"Metric.type":     validMetricTypes,
+		"MetricItem.func": validFunctions,
+		"Override.func":   validFunctions,
+		"MetricItem.mode": validCounterModes,
+	}
+
+	// Property documentation, keyed by "<go type name>" or "<go type name>.<property>"
+	schemaDescriptions = map[string]string{
+		"Collection":              "Simulator configuration",
+		"Collection.version":      "Version of the configuration format",
+		"Collection.metrics":      "The simulated metrics",
+		"Collection.scenarios":    "Timelines of phases which temporarily change the parameters of items",
+		"Collection.namespace":    "Prefix of all metric names",
+		"Collection.subsystem":    "Prefix of all metric names (after the namespace)",
+		"Collection.constLabels":  "Labels added to all series. Values can reference environment variables as $VAR",
+		"Metric":                  "A prometheus metric consisting of one or more items which differ by their label values",
+		"Metric.name":             "Name of the metric",
+		"Metric.help":             "Help text of the metric",
+		"Metric.type":             "Prometheus type of the metric",
+		"Metric.unit":             "OpenMetrics unit of the metric, e.g. seconds. Part of the configuration only, it is not exposed",
+		"Metric.labels":           "Label names which every item must specify",
+		"Metric.items":            "The metric items (time series) of the metric",
+		"Metric.churn":            "Periodic replacement of a label value of all items, like the pod name of a restarted k8s pod",
+		"Churn":                   "The label value is replaced by the item's value plus a random suffix every period and/or with a probability per refresh",
+		"Churn.label":             "Name of the churning label",
+		"Churn.every":             "Period after which the label value is replaced",
+		"Churn.probability":       "Probability (0-1) by which the label value is replaced upon each refresh",
+		"Metric.buckets":          "Bucket boundaries of a histogram. The prometheus default buckets if unset",
+		"Metric.quantiles":        "Quantiles (0-1) exposed by a summary",
+		"MetricItem":              "A single time series of a metric",
+		"Scenario":                "A timeline of phases, e.g. to script an incident",
+		"Scenario.name":           "Name of the scenario (used in log messages)",
+		"Scenario.loop":           "Start over after the last phase. Otherwise the items keep their own parameters after the last phase",
+		"Scenario.phases":         "The phases of the scenario in order",
+		"Phase":                   "A period of a scenario with its overrides",
+		"Phase.name":              "Name of the phase (used in log messages)",
+		"Phase.duration":          "Duration of the phase",
+		"Phase.overrides":         "Parameters which replace those of matching items during the phase",
+		"Override":                "Parameters which replace those of all matching items. Unset parameters are not changed",
+		"Override.metric":         "Name of the metric whose items match. Items of any metric match if unset",
+		"Override.selector":       "Labels which matching items must have",
+		"Override.min":            "Minimum value",
+		"Override.max":            "Maximum value",
+		"Override.func":           "Function by which the value changes between min and max over the interval",
+		"Override.interval":       "Duration in which the function repeats",
+		"MetricItem.min":          "Minimum value",
+		"MetricItem.max":          "Maximum value",
+		"MetricItem.func":         "Function by which the value changes between min and max over the interval",
+		"MetricItem.interval":     "Duration in which the function repeats, e.g. 5m or 1h30m",
+		"MetricItem.labels":       "Label values of the item. The label names must match the labels of the metric",
+		"MetricItem.start":        "Duration after the start of the simulation at which the item appears",
+		"MetricItem.end":          "Duration after the start of the simulation at which the item disappears",
+		"MetricItem.ttl":          "Duration after its start at which the item disappears",
+		"MetricItem.absence":      "Periodic absence of the item",
+		"MetricItem.rate":         "Observations per second of a histogram or summary. One observation per refresh if unset",
+		"MetricItem.distribution": "Distribution of the observations of a histogram or summary as ascending quantiles. Observations follow func between min and max if unset",
+		"MetricItem.initial":      "Starting value of a counter, added upon the first refresh",
+		"MetricItem.mode":         "How the value of a counter is added: upon every refresh (increment, the default) or as increase per second (rate)",
+		"Quantile":                "A point of a distribution: the given fraction of observations is less than or equal to the value",
+		"Quantile.quantile":       "Fraction of observations (0-1)",
+		"Quantile.value":          "Upper bound of the fraction of observations",
+		"Absence":                 "Within every period the item is absent for the given duration at the end of the period",
+		"Absence.every":           "Length of the period, counted from the start of the item",
+		"Absence.for":             "Duration of the absence",
+	}
+)
+
+// Create a JSON schema (draft-07) of the simulator configuration. The schema
+// is derived from the Collection type and its yaml tags.
+func JsonSchema() ([]byte, error) {
+	definitions := make(map[string]interface{})
+	schema := schemaForStruct(reflect.TypeOf(Collection{}), definitions)
+
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "sim-exporter configuration"
+	schema["definitions"] = definitions
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// Create the schema of a go type. Structs are added to definitions and
+// referenced.
+func schemaForType(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]interface{}{
+			"type":    "string",
+			"pattern": regexpDuration,
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaForType(t.Elem(), definitions)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": schemaForType(t.Elem(), definitions),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaForType(t.Elem(), definitions),
+		}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := definitions[name]; !ok {
+			// Register before descending to terminate on recursive types
+			definitions[name] = nil
+			definitions[name] = schemaForStruct(t, definitions)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + name}
+	}
+	// Anything else is not restricted
+	return map[string]interface{}{}
+}
+
+// Create the schema of a struct from its exported fields and their yaml tags
+func schemaForStruct(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := yamlFieldName(field)
+		if name == "-" {
+			continue
+		}
+
+		property := schemaForType(field.Type, definitions)
+		key := t.Name() + "." + name
+		if enum, ok := schemaEnums[key]; ok {
+			property["enum"] = enum
+		}
+		if description, ok := schemaDescriptions[key]; ok {
+			property["description"] = description
+		}
+		properties[name] = property
+	}
+
+	result := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if required, ok := schemaRequired[t.Name()]; ok {
+		result["required"] = required
+	}
+	if description, ok := schemaDescriptions[t.Name()]; ok {
+		result["description"] = description
+	}
+	return result
+}
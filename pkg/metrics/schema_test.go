@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+func compileSchema(t *testing.T) *jsonschema.Schema {
+	schema, err := JsonSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("schema.json", bytes.NewReader(schema)); err != nil {
+		t.Fatal(err)
+	}
+	result, err := compiler.Compile("schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// Convert yaml to the generic structure produced by encoding/json
+func yamlToJsonValue(data []byte) (interface{}, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	err = json.Unmarshal(jsonData, &result)
+	return result, err
+}
+
+func Test_JsonSchema_files(t *testing.T) {
+	schema := compileSchema(t)
+
+	var files []string
+	for _, pattern := range []string{"../../examples/*.yaml", "testdata/*.yaml", "testdata/merge/*.y*ml"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		t.Fatal("no files to validate")
+	}
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, err := yamlToJsonValue(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := schema.Validate(value); err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+func Test_JsonSchema_content(t *testing.T) {
+	schema := compileSchema(t)
+
+	tests := []struct {
+		name    string
+		content []string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: sin",
+				"    interval: 1h30m",
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing-version",
+			content: []string{
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: sin",
+				"    interval: 1m",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown-type",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: foo",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: sin",
+				"    interval: 1m",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown-func",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: cos",
+				"    interval: 1m",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid-duration",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: sin",
+				"    interval: 1 minute",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown-field",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: sin",
+				"    intervall: 1m",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := yamlToJsonValue([]byte(strings.Join(tt.content, "\n")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := schema.Validate(value); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
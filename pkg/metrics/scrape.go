@@ -0,0 +1,327 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	// A HELP, TYPE or UNIT comment of a scrape
+	regexpScrapeComment = regexp.MustCompile(`^#\s+(HELP|TYPE|UNIT)\s+(\S+)(.*)$`)
+
+	// The metric name of a sample line
+	regexpSampleName = regexp.MustCompile(`^\s*([a-zA-Z_:][a-zA-Z0-9_:]*)`)
+
+	// OpenMetrics types which the text format parser does not know. Their
+	// families are parsed as untyped.
+	openMetricsOnlyTypes = []string{"info", "stateset", "gaugehistogram", "unknown"}
+)
+
+// A metric family of a scrape
+type scrapeFamily struct {
+	name       string
+	help       string
+	metricType string
+	unit       string
+
+	// Index of the first line of the family
+	line int
+
+	// Whether the family holds the "_created" samples of a counter,
+	// histogram or summary (named like it plus "_created")
+	created bool
+
+	metrics []*dto.Metric
+}
+
+// The lines of a metric family of a scrape, regrouped for the parser
+type scrapeLines struct {
+	name     string
+	created  bool
+	help     *scrapeLine
+	typ      *scrapeLine
+	samples  []scrapeLine
+	first    int
+	regroup  bool
+	typeLate bool
+}
+
+// A line of a scrape with its index
+type scrapeLine struct {
+	text  string
+	index int
+}
+
+// The value of a sample of a counter, gauge or untyped family
+func sampleValue(m *dto.Metric) float64 {
+	switch {
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	default:
+		return m.Untyped.GetValue()
+	}
+}
+
+// The labels of a sample, nil if it has none
+func sampleLabels(m *dto.Metric) map[string]string {
+	if len(m.Label) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(m.Label))
+	for _, pair := range m.Label {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return labels
+}
+
+// Parse a scrape in the prometheus text format or OpenMetrics (detected if
+// format is empty) into its metric families, in the order of their first
+// line. The OpenMetrics types info, stateset, gaugehistogram and unknown and
+// UNIT comments are also understood in the text format.
+//
+// The parse is tolerant. The lines of every family are regrouped, so HELP and
+// TYPE may come in any order and samples may be interleaved with those of
+// other families, except for the "_created" samples which OpenMetrics puts
+// after every sample of a counter. Families without TYPE are untyped. A
+// missing HELP is only noted for the text format. The "_created" samples
+// of counters, histograms and summaries become families of their own. The
+// notes tell what had to be assumed. Lines which the parser rejects (e.g.
+// separators or invalid values) are skipped, the notes tell their number.
+func parseScrape(lines *[]string, format string) ([]*scrapeFamily, []string, error) {
+	if format == "" {
+		format = detectScrapeFormat(lines)
+	}
+	if format == ScrapeFormatOpenMetrics {
+		lines = openMetricsToText(lines)
+	}
+
+	// The parser stops at the first error, so parse again without the
+	// rejected line until it succeeds. Every round skips another line.
+	skipped := make(map[int]string)
+	for {
+		families, notes, err := parseScrapeText(lines, format, skipped)
+		parseErr, ok := err.(expfmt.ParseError)
+		if !ok || parseErr.Line < 1 || parseErr.Line > len(*lines) {
+			return families, notes, err
+		}
+		if _, ok := skipped[parseErr.Line-1]; ok {
+			return nil, nil, err
+		}
+		skipped[parseErr.Line-1] = parseErr.Msg
+	}
+}
+
+// Parse the lines of a scrape in the text format, without the skipped lines
+// (index to the reason). Errors tell the number of the original line.
+func parseScrapeText(lines *[]string, format string, skipped map[int]string) ([]*scrapeFamily, []string, error) {
+	var notes []string
+	if len(skipped) > 0 {
+		remaining := append([]string{}, *lines...)
+		var indexes []int
+		for index := range skipped {
+			remaining[index] = ""
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+		for _, index := range indexes {
+			notes = append(notes, fmt.Sprintf("skipped line %v: %v", index+1, skipped[index]))
+		}
+		lines = &remaining
+	}
+
+	types := make(map[string]string)
+	units := make(map[string]string)
+	for _, line := range *lines {
+		matches := regexpScrapeComment.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		value := strings.TrimSpace(matches[3])
+		switch matches[1] {
+		case "TYPE":
+			if _, ok := types[matches[2]]; !ok {
+				types[matches[2]] = value
+			}
+		case "UNIT":
+			units[matches[2]] = value
+		}
+	}
+
+	// The family a sample belongs to
+	familyOf := func(name string) string {
+		if _, ok := types[name]; ok {
+			return name
+		}
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			base := strings.TrimSuffix(name, suffix)
+			if t := types[base]; base != name && (t == "histogram" || t == "summary" || t == "gaugehistogram") {
+				return base
+			}
+		}
+		if base := strings.TrimSuffix(name, "_info"); types[base] == "info" {
+			return base
+		}
+		return name
+	}
+
+	var order []*scrapeLines
+	groups := make(map[string]*scrapeLines)
+	group := func(name string, index int) *scrapeLines {
+		g, ok := groups[name]
+		if !ok {
+			g = &scrapeLines{name: name, first: index}
+			groups[name] = g
+			order = append(order, g)
+		}
+		return g
+	}
+	var last string
+	for k, line := range *lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if matches := regexpScrapeComment.FindStringSubmatch(line); matches != nil {
+			g := group(matches[2], k)
+			switch matches[1] {
+			case "HELP":
+				if g.help != nil {
+					notes = append(notes, fmt.Sprintf("metric %q: ignored second HELP in line %v", g.name, k+1))
+					continue
+				}
+				g.help = &scrapeLine{text: matches[3], index: k}
+			case "TYPE":
+				if g.typ != nil {
+					notes = append(notes, fmt.Sprintf("metric %q: ignored second TYPE in line %v", g.name, k+1))
+					continue
+				}
+				g.typ = &scrapeLine{text: line, index: k}
+				g.typeLate = len(g.samples) > 0
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		name := fmt.Sprintf("\xff%v", k)
+		if matches := regexpSampleName.FindStringSubmatch(line); matches != nil {
+			name = familyOf(matches[1])
+		}
+		g := group(name, k)
+		if base := strings.TrimSuffix(name, "_created"); base != name && (types[base] == "counter" || types[base] == "histogram" || types[base] == "summary") {
+			g.created = true
+		}
+		// "_created" samples may alternate with those of their family, like
+		// _bucket, _count and _sum do
+		owner := name
+		if g.created {
+			owner = strings.TrimSuffix(name, "_created")
+		}
+		if len(g.samples) > 0 && last != owner {
+			g.regroup = true
+		}
+		g.samples = append(g.samples, scrapeLine{text: line, index: k})
+		last = owner
+	}
+
+	// Write the families one after the other. Info families are renamed to
+	// the name of their samples and the parser treats OpenMetrics types as
+	// untyped. Remember the original index of every line.
+	var text strings.Builder
+	var indexes []int
+	write := func(line string, index int) {
+		text.WriteString(line)
+		text.WriteString("\n")
+		indexes = append(indexes, index)
+	}
+	for _, g := range order {
+		if len(g.samples) == 0 {
+			continue
+		}
+		name := g.name
+		if strings.HasPrefix(name, "\xff") {
+			write(g.samples[0].text, g.samples[0].index)
+			continue
+		}
+		if types[name] == "info" {
+			name += "_info"
+		}
+		if g.created && g.help == nil && g.typ == nil {
+			write("# TYPE "+name+" gauge", g.samples[0].index)
+			for _, sample := range g.samples {
+				write(sample.text, sample.index)
+			}
+			continue
+		}
+		if g.help != nil {
+			write("# HELP "+name+g.help.text, g.help.index)
+		} else if format != ScrapeFormatOpenMetrics {
+			// HELP is optional in OpenMetrics
+			notes = append(notes, fmt.Sprintf("metric %q: no HELP", g.name))
+		}
+		if g.typ != nil {
+			if types[g.name] == "gaugehistogram" {
+				write("# TYPE "+name+" histogram", g.typ.index)
+			} else if isInSlice(types[g.name], openMetricsOnlyTypes) {
+				write("# TYPE "+name+" untyped", g.typ.index)
+			} else {
+				write(g.typ.text, g.typ.index)
+			}
+		} else {
+			notes = append(notes, fmt.Sprintf("metric %q: no TYPE, assumed untyped", g.name))
+		}
+		if g.typeLate {
+			notes = append(notes, fmt.Sprintf("metric %q: TYPE in line %v after the first sample", g.name, g.typ.index+1))
+		}
+		if g.regroup {
+			notes = append(notes, fmt.Sprintf("metric %q: regrouped samples interleaved with other metrics", g.name))
+		}
+		for _, sample := range g.samples {
+			write(sample.text, sample.index)
+		}
+	}
+
+	var parser expfmt.TextParser
+	parsed, err := parser.TextToMetricFamilies(strings.NewReader(text.String()))
+	if err != nil {
+		// Refer to the original line
+		if parseErr, ok := err.(expfmt.ParseError); ok && parseErr.Line >= 1 && parseErr.Line <= len(indexes) {
+			parseErr.Line = indexes[parseErr.Line-1] + 1
+			return nil, nil, parseErr
+		}
+		return nil, nil, err
+	}
+
+	result := make([]*scrapeFamily, 0, len(parsed))
+	for _, g := range order {
+		name := g.name
+		if types[name] == "info" {
+			name += "_info"
+		}
+		mf, ok := parsed[name]
+		if !ok {
+			continue
+		}
+		family := &scrapeFamily{
+			name:       g.name,
+			help:       mf.GetHelp(),
+			metricType: strings.ToLower(mf.GetType().String()),
+			unit:       units[g.name],
+			line:       g.first,
+			created:    g.created,
+			metrics:    mf.Metric,
+		}
+		if isInSlice(types[g.name], openMetricsOnlyTypes) {
+			family.metricType = types[g.name]
+		}
+		result = append(result, family)
+	}
+	return result, notes, nil
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseScrape(t *testing.T) {
+	type family struct {
+		name       string
+		help       string
+		metricType string
+		samples    int
+	}
+	tests := []struct {
+		name      string
+		lines     []string
+		want      []family
+		wantNotes []string
+	}{
+		{
+			name: "well-formed",
+			lines: []string{
+				`# HELP a Help of a`,
+				`# TYPE a gauge`,
+				`a 1`,
+				`# HELP b Help of b`,
+				`# TYPE b counter`,
+				`b 2`,
+			},
+			want: []family{{"a", "Help of a", "gauge", 1}, {"b", "Help of b", "counter", 1}},
+		},
+		{
+			name:      "no-metadata",
+			lines:     []string{`a{l="x"} 1`, `a{l="y"} 2`},
+			want:      []family{{"a", "", "untyped", 2}},
+			wantNotes: []string{`metric "a": no HELP`, `metric "a": no TYPE, assumed untyped`},
+		},
+		{
+			name:      "type-without-help",
+			lines:     []string{`# TYPE a gauge`, `a 1`},
+			want:      []family{{"a", "", "gauge", 1}},
+			wantNotes: []string{`metric "a": no HELP`},
+		},
+		{
+			name:  "type-before-help",
+			lines: []string{`# TYPE a gauge`, `# HELP a Help of a`, `a 1`},
+			want:  []family{{"a", "Help of a", "gauge", 1}},
+		},
+		{
+			name:      "type-after-samples",
+			lines:     []string{`# HELP a Help of a`, `a 1`, `# TYPE a counter`},
+			want:      []family{{"a", "Help of a", "counter", 1}},
+			wantNotes: []string{`metric "a": TYPE in line 3 after the first sample`},
+		},
+		{
+			name: "interleaved",
+			lines: []string{
+				`# TYPE a gauge`,
+				`# TYPE b gauge`,
+				`a{l="x"} 1`,
+				`b 2`,
+				`a{l="y"} 3`,
+			},
+			want: []family{{"a", "", "gauge", 2}, {"b", "", "gauge", 1}},
+			wantNotes: []string{
+				`metric "a": no HELP`,
+				`metric "a": regrouped samples interleaved with other metrics`,
+				`metric "b": no HELP`,
+			},
+		},
+		{
+			name: "duplicate-metadata",
+			lines: []string{
+				`# HELP a Help of a`,
+				`# TYPE a gauge`,
+				`# HELP a Other help`,
+				`# TYPE a counter`,
+				`a 1`,
+			},
+			want: []family{{"a", "Help of a", "gauge", 1}},
+			wantNotes: []string{
+				`metric "a": ignored second HELP in line 3`,
+				`metric "a": ignored second TYPE in line 4`,
+			},
+		},
+		{
+			name: "histogram",
+			lines: []string{
+				`# HELP h Help of h`,
+				`# TYPE h histogram`,
+				`h_bucket{le="1"} 1`,
+				`h_bucket{le="+Inf"} 2`,
+				`h_sum 3`,
+				`h_count 2`,
+			},
+			want: []family{{"h", "Help of h", "histogram", 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			families, notes, err := parseScrape(&tt.lines, "")
+			if err != nil {
+				t.Fatalf("parseScrape() error = %v", err)
+			}
+			var got []family
+			for _, f := range families {
+				got = append(got, family{f.name, f.help, f.metricType, len(f.metrics)})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseScrape() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(notes, tt.wantNotes) {
+				t.Errorf("parseScrape() notes = %q, want %q", notes, tt.wantNotes)
+			}
+		})
+	}
+}
+
+func Test_parseScrape_skippedLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     []string
+		want      int
+		wantNotes []string
+	}{
+		{
+			name:      "separator",
+			lines:     []string{`# TYPE a gauge`, `a 1`, `-----`, `# TYPE b gauge`, `b 2`},
+			want:      2,
+			wantNotes: []string{`skipped line 3: invalid metric name`, `metric "a": no HELP`, `metric "b": no HELP`},
+		},
+		{
+			// The line number is the original one although the lines of "a"
+			// are regrouped before those of "b"
+			name:      "invalid-value",
+			lines:     []string{`# TYPE a gauge`, `# TYPE b gauge`, `a 1`, `b 2`, `a{l="x"} abc`},
+			want:      2,
+			wantNotes: []string{`skipped line 5: expected float as value, got "abc"`, `metric "a": no HELP`, `metric "b": no HELP`},
+		},
+		{
+			name:      "unterminated-label-value",
+			lines:     []string{`# TYPE a gauge`, `a{l="x} 1`, `a 2`},
+			want:      1,
+			wantNotes: []string{`skipped line 2: label value "x} 1" contains unescaped new-line`, `metric "a": no HELP`},
+		},
+		{
+			name:      "unknown-type",
+			lines:     []string{`# HELP a help`, `# TYPE a foo`, `a 1`},
+			want:      1,
+			wantNotes: []string{`skipped line 2: unknown metric type "foo"`, `metric "a": no TYPE, assumed untyped`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			families, notes, err := parseScrape(&tt.lines, "")
+			if err != nil {
+				t.Fatalf("parseScrape() error = %v", err)
+			}
+			samples := 0
+			for _, f := range families {
+				samples += len(f.metrics)
+			}
+			if samples != tt.want {
+				t.Errorf("parseScrape() samples = %v, want %v", samples, tt.want)
+			}
+			if !reflect.DeepEqual(notes, tt.wantNotes) {
+				t.Errorf("parseScrape() notes = %q, want %q", notes, tt.wantNotes)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Read all snapshots of the sources. Files are read once, URLs are fetched
+// samples times with period in between.
+func readSnapshots(sources []string, fetch FetchOptions, samples int, period time.Duration) ([]*[]string, error) {
+	var result []*[]string
+	for round := 0; round < samples; round++ {
+		if round > 0 {
+			time.Sleep(period)
+		}
+		for _, source := range sources {
+			var lines *[]string
+			var err error
+			if isURL(source) {
+				lines, err = fetchLines(source, fetch)
+			} else if round == 0 {
+				lines, err = readLines(source)
+			} else {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, lines)
+		}
+	}
+	return result, nil
+}
+
+// Func which resembles the trend of values: asc or desc if they only move in
+// one direction, sin if they change direction now and then, rand if they
+// change direction most of the time. Empty if the values are flat.
+func trendFunc(values []float64) string {
+	var steps, turns, direction int
+	for k := 1; k < len(values); k++ {
+		d := 0
+		if values[k] > values[k-1] {
+			d = 1
+		} else if values[k] < values[k-1] {
+			d = -1
+		}
+		if d == 0 {
+			continue
+		}
+		steps++
+		if direction != 0 && d != direction {
+			turns++
+		}
+		direction = d
+	}
+	switch {
+	case steps == 0:
+		return ""
+	case turns == 0 && direction > 0:
+		return "asc"
+	case turns == 0:
+		return "desc"
+	case turns*2 > steps:
+		return "rand"
+	default:
+		return "sin"
+	}
+}
+
+// Identifies an item across snapshots
+func itemKey(metricName string, labels map[string]string) string {
+	var b strings.Builder
+	b.WriteString(metricName)
+	for _, name := range labelNames(labels) {
+		fmt.Fprintf(&b, "\xff%v\xff%v", name, labels[name])
+	}
+	return b.String()
+}
+
+// The increases per second between consecutive totals of a counter which are
+// period apart. Decreases are resets of the counter and skipped.
+func counterRates(totals []float64, period time.Duration) []float64 {
+	var result []float64
+	for k := 1; k < len(totals); k++ {
+		if delta := totals[k] - totals[k-1]; delta >= 0 {
+			result = append(result, delta/period.Seconds())
+		}
+	}
+	return result
+}
+
+// Convert several snapshots of the same source(s) into a collection. The
+// min and max of every item are the lowest and highest observed values and
+// the func follows the observed trend (see trendFunc). Items with a flat
+// trend get a func of the function list. Counters start at their first
+// observed total and their min, max and func are derived from the increases
+// per second between the snapshots instead. Histograms and summaries keep
+// the distribution and rate of their first snapshot. URLs are fetched
+// samples times with period in between, several files are assumed to be
+// period apart. Only the metrics and items selected by filter are converted.
+// The first matching rule (if any) overrides function, interval and honorpct,
+// its clamp limits the observed values.
+func SnapshotsToCollection(sources []string, fetch FetchOptions, filter ConvertFilter, rules *ConvertRules, samples int, period time.Duration, function string, interval string, honorpct string) (*Collection, error) {
+
+	// Assert correctness of input parameters
+	_, err := randomFunc(function)
+	if err != nil {
+		return nil, err
+	}
+	_, err = randomDuration(interval)
+	if err != nil {
+		return nil, err
+	}
+	if !IsValidScrapeFormat(fetch.Format) {
+		return nil, fmt.Errorf("unknown scrape format %q", fetch.Format)
+	}
+	if samples < 1 {
+		return nil, fmt.Errorf("samples must be 1 or more")
+	}
+	if period <= 0 {
+		return nil, fmt.Errorf("sample period must be positive")
+	}
+	_, err = filter.compile()
+	if err != nil {
+		return nil, err
+	}
+	err = rules.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := readSnapshots(sources, fetch, samples, period)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *Collection
+	observed := make(map[string][]float64)
+	for k, lines := range snapshots {
+		c, err := convertScrapeToConfig(lines, fetch.Format, filter, rules.withoutDeviation(), 0, function, interval, honorpct)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %v: %v", k+1, err)
+		}
+		if result == nil {
+			result = c
+		}
+		for _, m := range c.Metrics {
+			base, ok := result.GetMetric(m.Name)
+			if !ok {
+				base = m
+				if err := result.AddMetric(base); err != nil {
+					return nil, fmt.Errorf("snapshot %v: %v", k+1, err)
+				}
+			}
+			for _, item := range m.Items {
+				if _, ok := base.GetItem(item.Labels); !ok {
+					if err := base.AddItem(item); err != nil {
+						return nil, fmt.Errorf("snapshot %v: %v", k+1, err)
+					}
+				}
+				// Without deviation, min is the value of the snapshot
+				// except for counters which start at it
+				value := item.Min
+				if m.Type == "counter" && item.Mode != "" {
+					value = item.Initial
+				}
+				key := itemKey(m.Name, item.Labels)
+				observed[key] = append(observed[key], value)
+			}
+		}
+	}
+	if result == nil {
+		return nil, fmt.Errorf("no snapshots")
+	}
+
+	for _, m := range result.Metrics {
+		if m.Type == "summary" || m.Type == "histogram" || m.Type == "gaugehistogram" {
+			continue
+		}
+		for _, item := range m.Items {
+			values := observed[itemKey(m.Name, item.Labels)]
+			if m.Type == "counter" && item.Mode != "" {
+				item.Initial = values[0]
+				values = counterRates(values, period)
+				if len(values) == 0 {
+					// Keep the estimate of the first snapshot
+					continue
+				}
+				if item.Mode == "increment" {
+					for k := range values {
+						values[k] *= DefaultRefresh.Seconds()
+					}
+				}
+			}
+			sorted := append([]float64{}, values...)
+			sort.Float64s(sorted)
+			clamp := rules.settings(m.Name, item.Labels, convertSettings{}).clamp
+			item.Min, item.Max = clamp.apply(sorted[0]), clamp.apply(sorted[len(sorted)-1])
+			if f := trendFunc(values); f != "" {
+				item.Func = f
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_trendFunc(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   string
+	}{
+		{name: "single", values: []float64{1}, want: ""},
+		{name: "flat", values: []float64{3, 3, 3}, want: ""},
+		{name: "ascending", values: []float64{1, 2, 2, 5}, want: "asc"},
+		{name: "descending", values: []float64{5, 4, 4, 1}, want: "desc"},
+		{name: "periodic", values: []float64{0, 1, 2, 1, 0, 1, 2}, want: "sin"},
+		{name: "noisy", values: []float64{5, 1, 6, 2, 7}, want: "rand"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trendFunc(tt.values); got != tt.want {
+				t.Errorf("trendFunc() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotsToCollection(t *testing.T) {
+	files := []string{
+		"testdata/snapshots/scrape1.txt",
+		"testdata/snapshots/scrape2.txt",
+		"testdata/snapshots/scrape3.txt",
+		"testdata/snapshots/scrape4.txt",
+	}
+	c, err := SnapshotsToCollection(files, FetchOptions{}, ConvertFilter{}, nil, 1, 10*time.Second, "sin", "15s-1m", "percent")
+	if err != nil {
+		t.Fatalf("SnapshotsToCollection() error = %v", err)
+	}
+
+	tests := []struct {
+		metric   string
+		labels   map[string]string
+		min, max float64
+		function string
+		initial  float64
+	}{
+		{metric: "temperature_celsius", min: 20, max: 20, function: "sin"},
+		{metric: "requests_total", labels: map[string]string{"code": "200"}, min: 1, max: 1, function: "sin", initial: 10},
+		{metric: "requests_total", labels: map[string]string{"code": "500"}, min: 0, max: 0, function: "sin", initial: 7},
+		{metric: "queue_length", min: 20, max: 50, function: "desc"},
+		{metric: "load", min: 1, max: 3, function: "sin"},
+		{metric: "jitter_seconds", min: 1, max: 6, function: "rand"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.metric, tt.labels), func(t *testing.T) {
+			m, ok := c.GetMetric(tt.metric)
+			if !ok {
+				t.Fatalf("metric %q missing", tt.metric)
+			}
+			item, ok := m.GetItem(tt.labels)
+			if !ok {
+				t.Fatalf("item %v missing", tt.labels)
+			}
+			if item.Min != tt.min || item.Max != tt.max || item.Func != tt.function || item.Initial != tt.initial {
+				t.Errorf("item = %v-%v %v initial %v, want %v-%v %v initial %v", item.Min, item.Max, item.Func, item.Initial, tt.min, tt.max, tt.function, tt.initial)
+			}
+		})
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestSnapshotsToCollection_url(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, "# HELP requests_total Requests\n# TYPE requests_total counter\nrequests_total %v\n", requests*requests*10)
+	}))
+	defer server.Close()
+
+	c, err := SnapshotsToCollection([]string{server.URL}, FetchOptions{}, ConvertFilter{}, nil, 3, 10*time.Millisecond, "rand", "15s-1m", "percent")
+	if err != nil {
+		t.Fatalf("SnapshotsToCollection() error = %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("requests = %v, want 3", requests)
+	}
+	item := c.Metrics[0].Items[0]
+	// Totals 10, 40, 90 make increases of 3000 and 5000 per second
+	if item.Initial != 10 || item.Min != 3000 || item.Max != 5000 || item.Func != "asc" || item.Mode != "rate" {
+		t.Errorf("item = %v-%v %v initial %v mode %q, want 3000-5000 asc initial 10 mode rate", item.Min, item.Max, item.Func, item.Initial, item.Mode)
+	}
+
+	if _, err := SnapshotsToCollection([]string{server.URL}, FetchOptions{}, ConvertFilter{}, nil, 0, 0, "rand", "15s-1m", "percent"); err == nil {
+		t.Errorf("SnapshotsToCollection() with 0 samples succeeded, want error")
+	}
+}
+
+func TestSnapshotsToCollection_rules(t *testing.T) {
+	files := []string{
+		"testdata/snapshots/scrape1.txt",
+		"testdata/snapshots/scrape2.txt",
+		"testdata/snapshots/scrape3.txt",
+		"testdata/snapshots/scrape4.txt",
+	}
+	rules, err := ReadConvertRules("testdata/rules/convert_rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := SnapshotsToCollection(files, FetchOptions{}, ConvertFilter{}, rules, 1, 10*time.Second, "sin", "15s-1m", "percent")
+	if err != nil {
+		t.Fatalf("SnapshotsToCollection() error = %v", err)
+	}
+
+	// One request per second are 15 per refresh
+	requests, _ := c.GetMetric("requests_total")
+	item, _ := requests.GetItem(map[string]string{"code": "200"})
+	if item.Mode != "increment" || item.Min != 15 || item.Max != 15 || item.Initial != 10 {
+		t.Errorf("requests = %v-%v mode %q initial %v, want 15-15 increment initial 10", item.Min, item.Max, item.Mode, item.Initial)
+	}
+	// The observed queue length of 20-50 is clamped
+	queue, _ := c.GetMetric("queue_length")
+	if item := queue.Items[0]; item.Min != 45 || item.Max != 50 {
+		t.Errorf("queue = %v-%v, want 45-50", item.Min, item.Max)
+	}
+}
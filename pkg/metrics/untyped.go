@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Vector of untyped metrics partitioned by label values. client_golang only
+// offers untyped metrics as functions, so this implements the subset of the
+// *Vec API the simulator needs.
+type untypedVec struct {
+	desc       *prometheus.Desc
+	labelNames []string
+
+	mtx    sync.Mutex
+	series map[string]untypedSeries
+}
+
+type untypedSeries struct {
+	labelValues []string
+	value       float64
+}
+
+func newUntypedVec(opts prometheus.Opts, labelNames []string) *untypedVec {
+	return &untypedVec{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			opts.Help,
+			labelNames,
+			opts.ConstLabels,
+		),
+		labelNames: labelNames,
+		series:     make(map[string]untypedSeries),
+	}
+}
+
+// Set the value of the series with the given labels
+func (v *untypedVec) Set(labels map[string]string, value float64) {
+	labelValues := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		labelValues[i] = labels[name]
+	}
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.series[labelSetKey(labels)] = untypedSeries{labelValues: labelValues, value: value}
+}
+
+// Remove the series with the given labels. Returns whether it existed.
+func (v *untypedVec) Delete(labels map[string]string) bool {
+	key := labelSetKey(labels)
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	_, ok := v.series[key]
+	delete(v.series, key)
+	return ok
+}
+
+func (v *untypedVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- v.desc
+}
+
+func (v *untypedVec) Collect(ch chan<- prometheus.Metric) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	for _, s := range v.series {
+		ch <- prometheus.MustNewConstMetric(v.desc, prometheus.UntypedValue, s.value, s.labelValues...)
+	}
+}
@@ -0,0 +1,757 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// How the location of a metric or metric item within a collection is
+	// expressed in ValidationError paths
+	regexpItemPath = *regexp.MustCompile(`^metrics\[(?P<metric>\d+)\](?:\.items\[(?P<item>\d+)\])?`)
+
+	// How yaml reports type errors, e.g. "line 7: cannot unmarshal !!str `abc` into float64"
+	regexpYamlTypeError = *regexp.MustCompile("^line (?P<line>\\d+): (?P<msg>[^`]*(?:`(?P<value>[^`]*)`.*)?)$")
+)
+
+// Location within a config file
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	result := p.File
+	if p.Line > 0 {
+		if result != "" {
+			result += ":"
+		}
+		result += strconv.Itoa(p.Line)
+		if p.Column > 0 {
+			result += ":" + strconv.Itoa(p.Column)
+		}
+	}
+	return result
+}
+
+// A single problem of a collection
+type ValidationError struct {
+	Position
+
+	// Name of the affected metric (if any)
+	Metric string
+
+	// Index of the affected metric item within Metric (-1 if none)
+	Item int
+
+	Msg string
+
+	// Location within the collection, e.g. "metrics[1].items[0].min"
+	path string
+}
+
+func (e *ValidationError) Error() string {
+	result := ""
+	if pos := e.Position.String(); pos != "" {
+		result += pos + ": "
+	}
+	if e.Metric != "" {
+		result += fmt.Sprintf("metric %q", e.Metric)
+		if e.Item >= 0 {
+			result += fmt.Sprintf(" item %d", e.Item)
+		}
+		result += ": "
+	}
+	return result + e.Msg
+}
+
+// All problems of a collection
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+	return fmt.Sprintf("input has %v validation errors:\n  %v", len(e), strings.Join(lines, "\n  "))
+}
+
+// Create a validation error for the given path within a collection
+func newValidationError(path string, format string, a ...interface{}) *ValidationError {
+	return &ValidationError{
+		Item: -1,
+		Msg:  fmt.Sprintf(format, a...),
+		path: path,
+	}
+}
+
+// Check the semantics of a collection, e.g. one built in code. This is the
+// same validation which FromYamlFile applies. The result is nil or
+// ValidationErrors (without positions). Violations of naming conventions are
+// logged as warnings.
+func (c *Collection) Validate() error {
+	if validationErrors := c.check(nil, "", nil); len(validationErrors) > 0 {
+		return validationErrors
+	}
+	return nil
+}
+
+// Validate and normalize a collection. Earlier errors (e.g. from decoding)
+// are included in the result. Errors and warnings are located in the yaml
+// node tree the collection was read from, if any.
+func (c *Collection) check(validationErrors ValidationErrors, filename string, nodes map[string]*yaml.Node) ValidationErrors {
+	validationErrors = append(validationErrors, c.validate()...)
+	c.link()
+
+	validationErrors.describe(c)
+	validationErrors.locate(filename, nodes)
+	validationErrors.sort()
+
+	if len(validationErrors) > 0 {
+		return validationErrors
+	}
+
+	warnings := c.lint()
+	warnings.describe(c)
+	warnings.locate(filename, nodes)
+	warnings.sort()
+	for _, warning := range warnings {
+		log.Warn(warning)
+	}
+	return nil
+}
+
+// Set parent pointers and normalize what can be normalized
+func (c *Collection) link() {
+	for _, metric := range c.Metrics {
+		metric.parent = c
+		sort.Strings(metric.Labels)
+		for _, item := range metric.Items {
+			item.parent = metric
+		}
+	}
+}
+
+// Check the semantics of a collection. The errors reference their path
+// within the collection but have no position and metric/item information
+// yet, see describe().
+func (c *Collection) validate() ValidationErrors {
+	var result ValidationErrors
+
+	if c.Version == "" {
+		result = append(result, newValidationError("version", "missing version"))
+	}
+
+	if len(c.Metrics) == 0 {
+		result = append(result, newValidationError("metrics", "metrics must have one or more elements"))
+	}
+
+	for field, value := range map[string]string{"namespace": c.Namespace, "subsystem": c.Subsystem} {
+		if value != "" && !model.IsValidMetricName(model.LabelValue(value)) {
+			result = append(result, newValidationError(field, "invalid %v %q. Must match %v", field, value, model.MetricNameRE))
+		}
+	}
+
+	for name, value := range c.ConstLabels {
+		labelPath := "constLabels." + name
+		if !model.LabelName(name).IsValid() {
+			result = append(result, newValidationError(labelPath, "invalid label name %q. Must match %v", name, model.LabelNameRE))
+		} else if strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			result = append(result, newValidationError(labelPath, "label name %q is reserved (prefix %q)", name, model.ReservedLabelPrefix))
+		}
+		if !model.LabelValue(value).IsValid() {
+			result = append(result, newValidationError(labelPath, "invalid label value %q", value))
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, metric := range c.Metrics {
+		metricPath := fmt.Sprintf("metrics[%d]", i)
+
+		if seen[metric.Name] {
+			result = append(result, newValidationError(metricPath+".name", "duplicate metric name"))
+		}
+		seen[metric.Name] = true
+
+		if !model.IsValidMetricName(model.LabelValue(metric.Name)) {
+			result = append(result, newValidationError(metricPath+".name", "invalid metric name %q. Must match %v", metric.Name, model.MetricNameRE))
+		}
+
+		labelNames := make(map[string]bool)
+		for k, label := range metric.Labels {
+			labelPath := fmt.Sprintf("%v.labels[%d]", metricPath, k)
+			if !model.LabelName(label).IsValid() {
+				result = append(result, newValidationError(labelPath, "invalid label name %q. Must match %v", label, model.LabelNameRE))
+			} else if strings.HasPrefix(label, model.ReservedLabelPrefix) {
+				result = append(result, newValidationError(labelPath, "label name %q is reserved (prefix %q)", label, model.ReservedLabelPrefix))
+			} else if (metric.Type == "histogram" || metric.Type == "gaugehistogram") && label == model.BucketLabel || metric.Type == "summary" && label == model.QuantileLabel {
+				result = append(result, newValidationError(labelPath, "label name %q is reserved for type %v", label, metric.Type))
+			}
+			if labelNames[label] {
+				result = append(result, newValidationError(labelPath, "duplicate label name %q", label))
+			}
+			if _, ok := c.ConstLabels[label]; ok {
+				result = append(result, newValidationError(labelPath, "label name %q is already a const label", label))
+			}
+			labelNames[label] = true
+		}
+		sortedLabels := append([]string{}, metric.Labels...)
+		sort.Strings(sortedLabels)
+
+		if !isInSlice(metric.Type, validMetricTypes) {
+			result = append(result, newValidationError(metricPath+".type", "unknown type %q. Must be one of %v", metric.Type, strings.Join(validMetricTypes, ", ")))
+		}
+
+		if metric.Type == "stateset" {
+			// The state is exposed as label named like the metric
+			stateLabel := prometheus.BuildFQName(c.Namespace, c.Subsystem, metric.Name)
+			if !model.LabelName(stateLabel).IsValid() {
+				result = append(result, newValidationError(metricPath+".name", "name of stateset %q must be a valid label name", stateLabel))
+			}
+			if labelNames[stateLabel] {
+				result = append(result, newValidationError(metricPath+".labels", "label name %q is reserved for the state of the stateset", stateLabel))
+			}
+			if len(metric.States) == 0 {
+				result = append(result, newValidationError(metricPath+".states", "stateset must have one or more states"))
+			}
+			states := make(map[string]bool)
+			for k, state := range metric.States {
+				if states[state] {
+					result = append(result, newValidationError(fmt.Sprintf("%v.states[%d]", metricPath, k), "duplicate state %q", state))
+				}
+				states[state] = true
+			}
+		} else if len(metric.States) > 0 {
+			result = append(result, newValidationError(metricPath+".states", "states are only allowed for type stateset"))
+		}
+
+		if metric.Churn != nil {
+			churn := metric.Churn
+			if !isInSlice(churn.Label, metric.Labels) {
+				result = append(result, newValidationError(metricPath+".churn.label", "churn label %q is not a label of the metric", churn.Label))
+			}
+			if churn.Every < 0 {
+				result = append(result, newValidationError(metricPath+".churn.every", "invalid churn period. Must not be negative"))
+			}
+			if churn.Probability < 0 || churn.Probability > 1 {
+				result = append(result, newValidationError(metricPath+".churn.probability", "invalid churn probability %v. Must be in range 0-1", churn.Probability))
+			}
+			if churn.Every == 0 && churn.Probability == 0 {
+				result = append(result, newValidationError(metricPath+".churn", "churn needs a period (every) and/or a probability"))
+			}
+		}
+
+		isHistogram := metric.Type == "histogram" || metric.Type == "gaugehistogram"
+		if len(metric.Buckets) > 0 && !isHistogram {
+			result = append(result, newValidationError(metricPath+".buckets", "buckets are only allowed for histograms"))
+		}
+		for k, bucket := range metric.Buckets {
+			result = appendNonFinite(result, fmt.Sprintf("%v.buckets[%d]", metricPath, k), bucket)
+		}
+		for k := 1; k < len(metric.Buckets); k++ {
+			if metric.Buckets[k] <= metric.Buckets[k-1] {
+				result = append(result, newValidationError(fmt.Sprintf("%v.buckets[%d]", metricPath, k), "buckets must be in increasing order"))
+			}
+		}
+		if len(metric.Quantiles) > 0 && metric.Type != "summary" {
+			result = append(result, newValidationError(metricPath+".quantiles", "quantiles are only allowed for summaries"))
+		}
+		for k, q := range metric.Quantiles {
+			if q < 0 || q > 1 || math.IsNaN(q) {
+				result = append(result, newValidationError(fmt.Sprintf("%v.quantiles[%d]", metricPath, k), "invalid quantile %v. Must be in range 0-1", q))
+			}
+		}
+
+		if len(metric.Items) == 0 {
+			result = append(result, newValidationError(metricPath+".items", "must have at least one metric item"))
+		}
+
+		labelSets := make(map[string]int)
+		for j, item := range metric.Items {
+			itemPath := fmt.Sprintf("%v.items[%d]", metricPath, j)
+
+			result = appendNonFinite(result, itemPath+".min", item.Min)
+			result = appendNonFinite(result, itemPath+".max", item.Max)
+			result = appendNonFinite(result, itemPath+".initial", item.Initial)
+			result = appendNonFinite(result, itemPath+".rate", item.Rate)
+
+			if item.Min > item.Max {
+				result = append(result, newValidationError(itemPath+".min", "min (%v) > max (%v)", item.Min, item.Max))
+			}
+
+			if metric.Type == "stateset" && len(metric.States) > 0 && (item.Min < 0 || item.Max > float64(len(metric.States))) {
+				result = append(result, newValidationError(itemPath, "min and max must be in range 0-%d (the state index)", len(metric.States)))
+			}
+
+			if !isInSlice(item.Func, validFunctions) {
+				result = append(result, newValidationError(itemPath+".func", "unknown func %q. Must be one of %v", item.Func, strings.Join(validFunctions, ", ")))
+			}
+
+			if item.Interval <= 0 {
+				result = append(result, newValidationError(itemPath+".interval", "invalid interval. Must be 1s or longer"))
+			}
+
+			result = append(result, item.validateLifecycle(itemPath)...)
+			result = append(result, item.validateObservations(itemPath, isHistogram || metric.Type == "summary")...)
+			result = append(result, item.validateCounter(itemPath, metric.Type == "counter")...)
+
+			var keys []string
+			for key := range item.Labels {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if !stringSlicesEqual(keys, sortedLabels) {
+				result = append(result, newValidationError(itemPath+".labels", "label mismatch. Item=%v, metric=%v", keys, sortedLabels))
+			}
+
+			for _, key := range keys {
+				if !model.LabelValue(item.Labels[key]).IsValid() {
+					result = append(result, newValidationError(itemPath+".labels."+key, "invalid label value %q", item.Labels[key]))
+				}
+			}
+
+			labelSet := labelSetKey(item.Labels)
+			if other, ok := labelSets[labelSet]; ok {
+				result = append(result, newValidationError(itemPath+".labels", "duplicate label set, same as item %d", other))
+			} else {
+				labelSets[labelSet] = j
+			}
+		}
+	}
+
+	result = append(result, c.validateScenarios()...)
+
+	return result
+}
+
+// Check rate and distribution of an item. Both are only allowed for items of
+// histograms and summaries.
+func (i *MetricItem) validateObservations(itemPath string, observed bool) ValidationErrors {
+	var result ValidationErrors
+
+	if i.Rate != 0 && !observed {
+		result = append(result, newValidationError(itemPath+".rate", "rate is only allowed for histograms and summaries"))
+	} else if i.Rate < 0 {
+		result = append(result, newValidationError(itemPath+".rate", "invalid rate %v. Must not be negative", i.Rate))
+	}
+
+	if len(i.Distribution) > 0 && !observed {
+		result = append(result, newValidationError(itemPath+".distribution", "distribution is only allowed for histograms and summaries"))
+	}
+	for k, point := range i.Distribution {
+		pointPath := fmt.Sprintf("%v.distribution[%d]", itemPath, k)
+		result = appendNonFinite(result, pointPath+".value", point.Value)
+		if point.Quantile < 0 || point.Quantile > 1 || math.IsNaN(point.Quantile) {
+			result = append(result, newValidationError(pointPath+".quantile", "invalid quantile %v. Must be in range 0-1", point.Quantile))
+		}
+		if k > 0 && point.Quantile < i.Distribution[k-1].Quantile {
+			result = append(result, newValidationError(pointPath+".quantile", "quantiles must not decrease"))
+		}
+		if k > 0 && point.Value < i.Distribution[k-1].Value {
+			result = append(result, newValidationError(pointPath+".value", "values must not decrease"))
+		}
+	}
+
+	return result
+}
+
+// Check initial value and mode of an item. Both are only allowed for items of
+// counters, whose values must not be negative.
+func (i *MetricItem) validateCounter(itemPath string, counter bool) ValidationErrors {
+	var result ValidationErrors
+
+	if counter && i.Min < 0 {
+		result = append(result, newValidationError(itemPath+".min", "invalid min %v. A counter must not decrease", i.Min))
+	}
+
+	if i.Initial != 0 && !counter {
+		result = append(result, newValidationError(itemPath+".initial", "initial is only allowed for counters"))
+	} else if i.Initial < 0 {
+		result = append(result, newValidationError(itemPath+".initial", "invalid initial %v. Must not be negative", i.Initial))
+	}
+
+	if i.Mode != "" && !counter {
+		result = append(result, newValidationError(itemPath+".mode", "mode is only allowed for counters"))
+	} else if i.Mode != "" && !isInSlice(i.Mode, validCounterModes) {
+		result = append(result, newValidationError(itemPath+".mode", "unknown mode %q. Must be one of %v", i.Mode, strings.Join(validCounterModes, ", ")))
+	}
+
+	return result
+}
+
+// Check the scenarios of a collection
+func (c *Collection) validateScenarios() ValidationErrors {
+	var result ValidationErrors
+
+	names := make(map[string]bool)
+	for i, scenario := range c.Scenarios {
+		scenarioPath := fmt.Sprintf("scenarios[%d]", i)
+		if scenario.Name == "" {
+			result = append(result, newValidationError(scenarioPath, "scenario must have a name"))
+		} else if names[scenario.Name] {
+			result = append(result, newValidationError(scenarioPath+".name", "duplicate scenario name %q", scenario.Name))
+		}
+		names[scenario.Name] = true
+
+		if len(scenario.Phases) == 0 {
+			result = append(result, newValidationError(scenarioPath, "scenario must have one or more phases"))
+		}
+		for j, phase := range scenario.Phases {
+			phasePath := fmt.Sprintf("%v.phases[%d]", scenarioPath, j)
+			if phase.Name == "" {
+				result = append(result, newValidationError(phasePath, "phase must have a name"))
+			}
+			if phase.Duration <= 0 {
+				result = append(result, newValidationError(phasePath+".duration", "invalid duration. Must be 1s or longer"))
+			}
+			for k, o := range phase.Overrides {
+				overridePath := fmt.Sprintf("%v.overrides[%d]", phasePath, k)
+				if o.Min == nil && o.Max == nil && o.Func == "" && o.Interval == 0 {
+					result = append(result, newValidationError(overridePath, "override must change one or more of min, max, func, interval"))
+				}
+				if o.Min != nil {
+					result = appendNonFinite(result, overridePath+".min", *o.Min)
+				}
+				if o.Max != nil {
+					result = appendNonFinite(result, overridePath+".max", *o.Max)
+				}
+				if o.Min != nil && o.Max != nil && *o.Min > *o.Max {
+					result = append(result, newValidationError(overridePath+".min", "min (%v) > max (%v)", *o.Min, *o.Max))
+				}
+				if o.Func != "" && !isInSlice(o.Func, validFunctions) {
+					result = append(result, newValidationError(overridePath+".func", "unknown func %q. Must be one of %v", o.Func, strings.Join(validFunctions, ", ")))
+				}
+				if o.Interval < 0 {
+					result = append(result, newValidationError(overridePath+".interval", "invalid interval. Must be 1s or longer"))
+				}
+			}
+			result = append(result, phase.validateRanges(phasePath, c.Metrics)...)
+		}
+	}
+
+	return result
+}
+
+// Check that the overrides of the phase leave min <= max for every matching
+// item of metrics. An override which sets only one of min and max is combined
+// with the other of the item. The error is reported at the last override
+// which changes min or max of the item.
+func (p *Phase) validateRanges(phasePath string, metrics []*Metric) ValidationErrors {
+	var result ValidationErrors
+	reported := make(map[int]bool)
+	for _, metric := range metrics {
+		for j, item := range metric.Items {
+			effective := item.withOverrides(metric, p.Overrides)
+			if effective.Min <= effective.Max {
+				continue
+			}
+			last := -1
+			for k, o := range p.Overrides {
+				if (o.Min != nil || o.Max != nil) && o.matches(metric, item) {
+					last = k
+				}
+			}
+			// Without override, the range of the item itself is invalid. An
+			// override with both min and max is checked by itself.
+			if last < 0 || reported[last] || (p.Overrides[last].Min != nil && p.Overrides[last].Max != nil) {
+				continue
+			}
+			reported[last] = true
+			err := newValidationError(fmt.Sprintf("%v.overrides[%d]", phasePath, last), "min (%v) > max (%v) for metric %q item %d", effective.Min, effective.Max, metric.Name, j)
+			err.Position = p.Overrides[last].pos
+			result = append(result, err)
+		}
+	}
+	return result
+}
+
+// Add an error if value is NaN or infinite, which not every format (like
+// json) can hold
+func appendNonFinite(result ValidationErrors, path string, value float64) ValidationErrors {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		result = append(result, newValidationError(path, "invalid value %v. Must be a finite number", value))
+	}
+	return result
+}
+
+// Check the lifecycle settings of an item
+func (i *MetricItem) validateLifecycle(itemPath string) ValidationErrors {
+	var result ValidationErrors
+	if i.Start < 0 {
+		result = append(result, newValidationError(itemPath+".start", "invalid start. Must not be negative"))
+	}
+	if i.End < 0 {
+		result = append(result, newValidationError(itemPath+".end", "invalid end. Must not be negative"))
+	} else if i.End > 0 && i.End <= i.Start {
+		result = append(result, newValidationError(itemPath+".end", "end (%v) must be after start (%v)", i.End, i.Start))
+	}
+	if i.TTL < 0 {
+		result = append(result, newValidationError(itemPath+".ttl", "invalid ttl. Must not be negative"))
+	}
+	if i.End > 0 && i.TTL > 0 {
+		result = append(result, newValidationError(itemPath+".ttl", "only one of end and ttl can be set"))
+	}
+	if i.Absence != nil {
+		if i.Absence.Every <= 0 {
+			result = append(result, newValidationError(itemPath+".absence.every", "invalid absence period. Must be 1s or longer"))
+		}
+		if i.Absence.For <= 0 || i.Absence.For >= i.Absence.Every {
+			result = append(result, newValidationError(itemPath+".absence.for", "invalid absence duration. Must be positive and shorter than the period (%v)", i.Absence.Every))
+		}
+	}
+	return result
+}
+
+// Check a valid collection for violations of prometheus naming conventions.
+// These are no errors because prometheus can handle them.
+// See https://prometheus.io/docs/practices/naming/
+func (c *Collection) lint() ValidationErrors {
+	var result ValidationErrors
+
+	for i, metric := range c.Metrics {
+		namePath := fmt.Sprintf("metrics[%d].name", i)
+		name := prometheus.BuildFQName(c.Namespace, c.Subsystem, metric.Name)
+
+		if metric.Type == "counter" && !strings.HasSuffix(name, "_total") {
+			result = append(result, newValidationError(namePath, "counter name should have suffix \"_total\""))
+		}
+		if metric.Type != "counter" && strings.HasSuffix(name, "_total") {
+			result = append(result, newValidationError(namePath, "suffix \"_total\" should only be used for counters"))
+		}
+		if metric.Unit != "" && !strings.HasSuffix(strings.TrimSuffix(name, "_total"), "_"+metric.Unit) {
+			result = append(result, newValidationError(namePath, "name should have the unit %q as suffix", metric.Unit))
+		}
+		if strings.Contains(name, ":") {
+			result = append(result, newValidationError(namePath, "colons are reserved for recording rules"))
+		}
+		if metric.Type == "histogram" || metric.Type == "gaugehistogram" || metric.Type == "summary" {
+			for _, suffix := range []string{"_bucket", "_count", "_sum"} {
+				if strings.HasSuffix(name, suffix) {
+					result = append(result, newValidationError(namePath, "suffix %q collides with the series of a %v", suffix, metric.Type))
+				}
+			}
+		}
+	}
+
+	// Probably a typo, but the item may be defined in another file
+	for i, scenario := range c.Scenarios {
+		for j, phase := range scenario.Phases {
+			for k, o := range phase.Overrides {
+				if !c.overrideMatches(o) {
+					result = append(result, newValidationError(fmt.Sprintf("scenarios[%d].phases[%d].overrides[%d]", i, j, k), "override matches no item in this file"))
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// Whether an override matches any item of the collection
+func (c *Collection) overrideMatches(o *Override) bool {
+	for _, metric := range c.Metrics {
+		for _, item := range metric.Items {
+			if o.matches(metric, item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Fill metric name and item index of errors from their paths
+func (e ValidationErrors) describe(c *Collection) {
+	for _, err := range e {
+		matchMap := createMatchMap(regexpItemPath, err.path)
+		if len(matchMap) == 0 {
+			continue
+		}
+		i, _ := strconv.Atoi(matchMap["metric"])
+		if i < len(c.Metrics) {
+			err.Metric = c.Metrics[i].Name
+		}
+		if matchMap["item"] != "" {
+			err.Item, _ = strconv.Atoi(matchMap["item"])
+		}
+	}
+}
+
+// Fill the positions of errors from the yaml node tree they were found in.
+// Paths without node (e.g. missing fields) resolve to the closest parent.
+func (e ValidationErrors) locate(filename string, nodes map[string]*yaml.Node) {
+	for _, err := range e {
+		err.File = filename
+		if err.Line > 0 {
+			continue
+		}
+		path := err.path
+		for {
+			if node, ok := nodes[path]; ok {
+				err.Line = node.Line
+				err.Column = node.Column
+				break
+			}
+			if path == "" {
+				break
+			}
+			path = parentPath(path)
+		}
+	}
+}
+
+// Strip the last element of a path
+func parentPath(path string) string {
+	i := strings.LastIndexAny(path, ".[")
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+// Index all nodes of a yaml tree by their path
+func indexNodes(node *yaml.Node, path string, result map[string]*yaml.Node) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		result[path] = node
+		for _, child := range node.Content {
+			indexNodes(child, path, result)
+		}
+	case yaml.MappingNode:
+		result[path] = node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			indexNodes(node.Content[i+1], joinPath(path, node.Content[i].Value), result)
+		}
+	case yaml.SequenceNode:
+		result[path] = node
+		for i, child := range node.Content {
+			indexNodes(child, fmt.Sprintf("%v[%d]", path, i), result)
+		}
+	default:
+		result[path] = node
+	}
+}
+
+func joinPath(path string, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// Report mapping keys which do not correspond to a field of the go type the
+// node is decoded into
+func unknownFields(node *yaml.Node, t reflect.Type, path string) ValidationErrors {
+	var result ValidationErrors
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			result = append(result, unknownFields(child, t, path)...)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			childPath := joinPath(path, key.Value)
+			switch t.Kind() {
+			case reflect.Struct:
+				field, ok := yamlField(t, key.Value)
+				if !ok {
+					err := newValidationError(childPath, "unknown field %q", key.Value)
+					// Point to the key, the value may well be missing
+					err.Line, err.Column = key.Line, key.Column
+					result = append(result, err)
+					continue
+				}
+				result = append(result, unknownFields(value, field.Type, childPath)...)
+			case reflect.Map:
+				result = append(result, unknownFields(value, t.Elem(), childPath)...)
+			}
+		}
+	case yaml.SequenceNode:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, child := range node.Content {
+				result = append(result, unknownFields(child, t.Elem(), fmt.Sprintf("%v[%d]", path, i))...)
+			}
+		}
+	}
+
+	return result
+}
+
+// Find the exported struct field which is (un)marshaled by the given yaml key
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if yamlFieldName(field) == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Turn yaml type errors into validation errors. Yaml only reports the line,
+// the path is recovered from the node with the offending value on that line.
+func typeErrors(err *yaml.TypeError, nodes map[string]*yaml.Node) ValidationErrors {
+	var result ValidationErrors
+	for _, msg := range err.Errors {
+		validationError := newValidationError("", "%v", msg)
+		matchMap := createMatchMap(regexpYamlTypeError, msg)
+		if len(matchMap) > 0 {
+			line, _ := strconv.Atoi(matchMap["line"])
+			validationError.Msg = matchMap["msg"]
+			validationError.path = pathOfLine(nodes, line, matchMap["value"])
+			if validationError.path == "" {
+				validationError.Line = line
+			}
+		}
+		result = append(result, validationError)
+	}
+	return result
+}
+
+// Find the path of the scalar node with the given value on the given line
+func pathOfLine(nodes map[string]*yaml.Node, line int, value string) string {
+	result := ""
+	for path, node := range nodes {
+		if node.Kind == yaml.ScalarNode && node.Line == line && node.Value == value {
+			// Prefer the deepest path which is the value rather than its parent
+			if len(path) > len(result) {
+				result = path
+			}
+		}
+	}
+	return result
+}
+
+// Order errors by their position
+func (e ValidationErrors) sort() {
+	sort.SliceStable(e, func(i, j int) bool {
+		if e[i].File != e[j].File {
+			return e[i].File < e[j].File
+		}
+		if e[i].Line != e[j].Line {
+			return e[i].Line < e[j].Line
+		}
+		return e[i].Column < e[j].Column
+	})
+}
@@ -0,0 +1,551 @@
+package metrics
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_FromYamlFile_validationErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []string
+		want    []string
+	}{
+		{
+			name: "empty",
+			content: []string{
+				"",
+			},
+			want: []string{
+				"missing version",
+				"metrics must have one or more elements",
+			},
+		},
+		{
+			name: "unknown-field",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    intervall: 1m",
+			},
+			want: []string{
+				`6:5: metric "a" item 0: invalid interval. Must be 1s or longer`,
+				`9:5: metric "a" item 0: unknown field "intervall"`,
+			},
+		},
+		{
+			name: "wrong-value-type",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  items:",
+				"  - min: abc",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+			},
+			want: []string{
+				"6:10: metric \"a\" item 0: cannot unmarshal !!str `abc` into float64",
+			},
+		},
+		{
+			name: "item-errors",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  labels: [l1]",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    labels: {l1: v1}",
+				"  - min: 3",
+				"    max: 2",
+				"    func: cos",
+				"    interval: 1m",
+				"    labels: {l2: v1}",
+			},
+			want: []string{
+				`12:10: metric "a" item 1: min (3) > max (2)`,
+				`14:11: metric "a" item 1: unknown func "cos". Must be one of rand, asc, desc, sin`,
+				`16:13: metric "a" item 1: label mismatch. Item=[l2], metric=[l1]`,
+			},
+		},
+		{
+			name: "metric-errors",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"- name: a",
+				"  type: foo",
+			},
+			want: []string{
+				`10:3: metric "a": must have at least one metric item`,
+				`10:9: metric "a": duplicate metric name`,
+				`11:9: metric "a": unknown type "foo". Must be one of gauge, counter, summary, histogram, info, stateset, gaugehistogram, unknown, untyped`,
+			},
+		},
+		{
+			name: "naming-errors",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: happy-wave",
+				"  type: histogram",
+				"  labels: [1st, __name, le]",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    labels: {1st: a, __name: b, le: c}",
+			},
+			want: []string{
+				`3:9: metric "happy-wave": invalid metric name "happy-wave". Must match ^[a-zA-Z_:][a-zA-Z0-9_:]*$`,
+				`5:12: metric "happy-wave": invalid label name "1st". Must match ^[a-zA-Z_][a-zA-Z0-9_]*$`,
+				`5:17: metric "happy-wave": label name "__name" is reserved (prefix "__")`,
+				`5:25: metric "happy-wave": label name "le" is reserved for type histogram`,
+			},
+		},
+		{
+			name: "duplicate-label-set",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  labels: [l1, l2]",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    labels: {l1: a, l2: b}",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    labels: {l2: b, l1: a}",
+			},
+			want: []string{
+				`16:13: metric "a" item 1: duplicate label set, same as item 0`,
+			},
+		},
+		{
+			name: "stateset-errors",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: door",
+				"  type: stateset",
+				"  states: [open, open]",
+				"  items:",
+				"  - min: 0",
+				"    max: 3",
+				"    func: rand",
+				"    interval: 1m",
+				"- name: temperature",
+				"  type: gauge",
+				"  states: [hot]",
+				"  items:",
+				"  - min: 0",
+				"    max: 1",
+				"    func: rand",
+				"    interval: 1m",
+			},
+			want: []string{
+				`5:18: metric "door": duplicate state "open"`,
+				`7:5: metric "door" item 0: min and max must be in range 0-2 (the state index)`,
+				`13:11: metric "temperature": states are only allowed for type stateset`,
+			},
+		},
+		{
+			name: "lifecycle-errors",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    start: 10m",
+				"    end: 5m",
+				"    ttl: 1h",
+				"    absence:",
+				"      every: 1m",
+				"      for: 2m",
+			},
+			want: []string{
+				`11:10: metric "a" item 0: end (5m0s) must be after start (10m0s)`,
+				`12:10: metric "a" item 0: only one of end and ttl can be set`,
+				`15:12: metric "a" item 0: invalid absence duration. Must be positive and shorter than the period (1m0s)`,
+			},
+		},
+		{
+			name: "churn-errors",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  labels: [pod]",
+				"  churn:",
+				"    label: instance",
+				"    probability: 2",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    labels: {pod: api}",
+			},
+			want: []string{
+				`7:12: metric "a": churn label "instance" is not a label of the metric`,
+				`8:18: metric "a": invalid churn probability 2. Must be in range 0-1`,
+			},
+		},
+		{
+			name: "scenario-errors",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"scenarios:",
+				"- name: s",
+				"  phases:",
+				"  - name: p",
+				"    duration: 0s",
+				"    overrides:",
+				"    - min: 3",
+				"      max: 2",
+				"      func: cos",
+				"    - metric: a",
+				"- name: s",
+			},
+			want: []string{
+				`14:15: invalid duration. Must be 1s or longer`,
+				`16:12: min (3) > max (2)`,
+				`18:13: unknown func "cos". Must be one of rand, asc, desc, sin`,
+				`19:7: override must change one or more of min, max, func, interval`,
+				`20:3: scenario must have one or more phases`,
+				`20:9: duplicate scenario name "s"`,
+			},
+		},
+		{
+			name: "override-range-errors",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  labels: [pod]",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    labels: {pod: api}",
+				"  - min: 5",
+				"    max: 10",
+				"    func: rand",
+				"    interval: 1m",
+				"    labels: {pod: db}",
+				"scenarios:",
+				"- name: s",
+				"  phases:",
+				"  - name: p",
+				"    duration: 1m",
+				"    overrides:",
+				"    - max: 3",
+				"  - name: q",
+				"    duration: 1m",
+				"    overrides:",
+				"    - max: 3",
+				"    - selector: {pod: db}",
+				"      min: 1",
+				"  - name: r",
+				"    duration: 1m",
+				"    overrides:",
+				"    - min: 3",
+				"      func: sin",
+			},
+			want: []string{
+				`23:7: min (5) > max (3) for metric "a" item 1`,
+				`33:7: min (3) > max (2) for metric "a" item 0`,
+			},
+		},
+		{
+			name: "observation-errors",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: latency_seconds",
+				"  type: histogram",
+				"  buckets: [1, 0.5]",
+				"  quantiles: [0.5]",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    rate: -1",
+				"    distribution:",
+				"    - {quantile: 0.5, value: 2}",
+				"    - {quantile: 0.4, value: 1}",
+				"    - {quantile: 2, value: 3}",
+				"- name: temperature",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    rate: 1",
+			},
+			want: []string{
+				`5:16: metric "latency_seconds": buckets must be in increasing order`,
+				`6:14: metric "latency_seconds": quantiles are only allowed for summaries`,
+				`12:11: metric "latency_seconds" item 0: invalid rate -1. Must not be negative`,
+				`15:18: metric "latency_seconds" item 0: quantiles must not decrease`,
+				`15:30: metric "latency_seconds" item 0: values must not decrease`,
+				`16:18: metric "latency_seconds" item 0: invalid quantile 2. Must be in range 0-1`,
+				`24:11: metric "temperature" item 0: rate is only allowed for histograms and summaries`,
+			},
+		},
+		{
+			name: "counter-errors",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: requests_total",
+				"  type: counter",
+				"  items:",
+				"  - min: -1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    initial: -5",
+				"    mode: sometimes",
+				"- name: temperature",
+				"  type: gauge",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    initial: 10",
+				"    mode: rate",
+			},
+			want: []string{
+				`6:10: metric "requests_total" item 0: invalid min -1. A counter must not decrease`,
+				`10:14: metric "requests_total" item 0: invalid initial -5. Must not be negative`,
+				`11:11: metric "requests_total" item 0: unknown mode "sometimes". Must be one of increment, rate`,
+				`19:14: metric "temperature" item 0: initial is only allowed for counters`,
+				`20:11: metric "temperature" item 0: mode is only allowed for counters`,
+			},
+		},
+		{
+			name: "non-finite",
+			content: []string{
+				"version: \"1\"",
+				"metrics:",
+				"- name: temperature",
+				"  type: gauge",
+				"  items:",
+				"  - min: .nan",
+				"    max: .inf",
+				"    func: rand",
+				"    interval: 1m",
+				"- name: latency_seconds",
+				"  type: histogram",
+				"  buckets: [1, .inf]",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    distribution:",
+				"    - {quantile: 0, value: -.inf}",
+				"    - {quantile: 1, value: 2}",
+			},
+			want: []string{
+				`6:10: metric "temperature" item 0: invalid value NaN. Must be a finite number`,
+				`7:10: metric "temperature" item 0: invalid value +Inf. Must be a finite number`,
+				`12:16: metric "latency_seconds": invalid value +Inf. Must be a finite number`,
+				`19:28: metric "latency_seconds" item 0: invalid value -Inf. Must be a finite number`,
+			},
+		},
+		{
+			name: "const-label-errors",
+			content: []string{
+				"version: \"1\"",
+				"namespace: my-sim",
+				"constLabels:",
+				"  l1: a",
+				"  replica: ${SIM_EXPORTER_TEST_UNSET}",
+				"metrics:",
+				"- name: a",
+				"  type: gauge",
+				"  labels: [l1]",
+				"  items:",
+				"  - min: 1",
+				"    max: 2",
+				"    func: rand",
+				"    interval: 1m",
+				"    labels: {l1: a}",
+			},
+			want: []string{
+				`2:12: invalid namespace "my-sim". Must match ^[a-zA-Z_:][a-zA-Z0-9_:]*$`,
+				`5:12: environment variable "SIM_EXPORTER_TEST_UNSET" is not set`,
+				`9:12: metric "a": label name "l1" is already a const label`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempFile, err := generateTempConfig(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(tempFile)
+
+			_, err = FromYamlFile(tempFile)
+			var validationErrors ValidationErrors
+			if !errors.As(err, &validationErrors) {
+				t.Fatalf("FromYamlFile() error = %v, want ValidationErrors", err)
+			}
+			var got []string
+			for _, e := range validationErrors {
+				if e.File != tempFile {
+					t.Errorf("FromYamlFile() error file = %v, want %v", e.File, tempFile)
+				}
+				e.File = ""
+				got = append(got, e.Error())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromYamlFile() errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_FromYamlPaths_validationErrors(t *testing.T) {
+	_, err := FromYamlPaths([]string{"testdata/merge/a.yaml", "testdata/merge_conflict.yaml"})
+	want := "input has 1 validation errors:\n" +
+		"  testdata/merge_conflict.yaml:3:3: metric \"merge_a\": conflicting labels [l2], already defined with labels [l1] at testdata/merge/a.yaml:3:3"
+	if err == nil || err.Error() != want {
+		t.Errorf("FromYamlPaths() error = %v, want %v", err, want)
+	}
+}
+
+func Test_FromYamlPaths_overrideRangeErrors(t *testing.T) {
+	_, err := FromYamlPaths([]string{"testdata/merge/a.yaml", "testdata/merge_override_range.yaml"})
+	want := "input has 1 validation errors:\n" +
+		"  testdata/merge_override_range.yaml:16:7: min (100) > max (2) for metric \"merge_a\" item 0"
+	if err == nil || err.Error() != want {
+		t.Errorf("FromYamlPaths() error = %v, want %v", err, want)
+	}
+}
+
+func TestCollection_lint(t *testing.T) {
+	tests := []struct {
+		name       string
+		metricType string
+		unit       string
+		want       []string
+	}{
+		{name: "requests_total", metricType: "counter"},
+		{name: "requests", metricType: "counter", want: []string{`counter name should have suffix "_total"`}},
+		{name: "temperature_total", metricType: "gauge", want: []string{`suffix "_total" should only be used for counters`}},
+		{name: "job:requests:rate5m", metricType: "gauge", want: []string{"colons are reserved for recording rules"}},
+		{name: "latency_sum", metricType: "summary", want: []string{`suffix "_sum" collides with the series of a summary`}},
+		{name: "latency_seconds", metricType: "histogram"},
+		{name: "latency_seconds", metricType: "histogram", unit: "seconds"},
+		{name: "latency", metricType: "gauge", unit: "seconds", want: []string{`name should have the unit "seconds" as suffix`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collection{
+				Version: "1",
+				Metrics: []*Metric{{Name: tt.name, Type: tt.metricType, Unit: tt.unit}},
+			}
+			var got []string
+			for _, warning := range c.lint() {
+				got = append(got, warning.Msg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPosition_String(t *testing.T) {
+	tests := []struct {
+		pos  Position
+		want string
+	}{
+		{pos: Position{}, want: ""},
+		{pos: Position{File: "a.yaml"}, want: "a.yaml"},
+		{pos: Position{File: "a.yaml", Line: 3}, want: "a.yaml:3"},
+		{pos: Position{File: "a.yaml", Line: 3, Column: 5}, want: "a.yaml:3:5"},
+		{pos: Position{Line: 3, Column: 5}, want: "3:5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.pos.String(); got != tt.want {
+				t.Errorf("String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parentPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "metrics[1].items[0].min", want: "metrics[1].items[0]"},
+		{path: "metrics[1].items[0]", want: "metrics[1].items"},
+		{path: "metrics[1].items", want: "metrics[1]"},
+		{path: "metrics[1]", want: "metrics"},
+		{path: "metrics", want: ""},
+		{path: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := parentPath(tt.path); got != tt.want {
+				t.Errorf("parentPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}